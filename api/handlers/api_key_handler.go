@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/apikeys"
+	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/validators"
+	"strconv"
+	"time"
+)
+
+type ApiKeyHandler struct {
+	Db *sql.DB
+}
+
+func (env *ApiKeyHandler) AddApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var apiKey models.ApiKey
+
+		err := json.NewDecoder(r.Body).Decode(&apiKey)
+		if err != nil {
+			problem.WriteError(w, r, decodeError(err))
+			return
+		}
+
+		if err = validators.ValidateApiKey(&apiKey); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		token, prefix, hash, err := apikeys.Generate()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error while generating api key", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+		apiKey.Prefix = prefix
+
+		id, err := repository.AddApiKey(r.Context(), &apiKey, hash, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		// The token is only returned here, it cannot be retrieved later
+		response := map[string]interface{}{
+			"id":      id,
+			"prefix":  prefix,
+			"token":   token,
+			"message": fmt.Sprintf("Added new api key with id: %v, store its token now", id),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ApiKeyHandler) GetAllApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		apiKeys, err := repository.GetAllApiKeys(r.Context(), env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if len(apiKeys) == 0 {
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No api keys found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(apiKeys)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ApiKeyHandler) RotateApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing api key ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid api key ID")
+			return
+		}
+
+		// The previous token keeps working for the grace period, so clients can be updated without downtime
+		grace := time.Duration(0)
+		if graceStr := r.URL.Query().Get("grace"); graceStr != "" {
+			grace, err = time.ParseDuration(graceStr)
+			if err != nil || grace < 0 {
+				problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid grace period, expected a duration such as 24h")
+				return
+			}
+		}
+
+		apiKey, err := repository.GetApiKeyByID(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		token, hash, err := apikeys.GenerateSecret(apiKey.Prefix)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error while generating api key", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+		err = repository.RotateApiKey(r.Context(), id, hash, grace, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"id":      id,
+			"token":   token,
+			"message": fmt.Sprintf("Rotated api key %d, the previous token expires in %v", id, grace),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ApiKeyHandler) RevokeApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing api key ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid api key ID")
+			return
+		}
+
+		err = repository.RevokeApiKey(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": fmt.Sprintf("Revoked api key: %v", id),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
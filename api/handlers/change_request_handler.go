@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/middlewares"
+	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/validators"
+	"strconv"
+)
+
+type ChangeRequestHandler struct {
+	Db *sql.DB
+}
+
+func (env *ChangeRequestHandler) SubmitChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var changeRequest models.ChangeRequest
+
+		err := json.NewDecoder(r.Body).Decode(&changeRequest)
+		if err != nil {
+			problem.WriteError(w, r, decodeError(err))
+			return
+		}
+
+		// The author is the authenticated principal, never the one claimed by the body
+		changeRequest.SubmittedBy = middlewares.RequestPrincipal(r).Name
+		if err = validators.ValidateChangeRequest(&changeRequest); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		if changeRequest.ScheduleId != nil {
+			if _, err = repository.GetScheduleByID(r.Context(), *changeRequest.ScheduleId, false, env.Db); err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+		}
+
+		id, err := repository.AddChangeRequest(r.Context(), &changeRequest, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		message := fmt.Sprintf("Submitted change request with id: %v", id)
+		response := map[string]interface{}{
+			"id":      id,
+			"message": message,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ChangeRequestHandler) GetAllChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status := r.URL.Query().Get("status")
+		changeRequests, err := repository.GetChangeRequests(r.Context(), status, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if len(changeRequests) == 0 {
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No change requests found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(changeRequests)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ChangeRequestHandler) GetChangeRequestByIDHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing change request ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid change request ID")
+			return
+		}
+
+		changeRequest, err := repository.GetChangeRequestByID(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(changeRequest)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ChangeRequestHandler) ApproveChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
+	env.reviewChangeRequest(w, r, true)
+}
+
+func (env *ChangeRequestHandler) RejectChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
+	env.reviewChangeRequest(w, r, false)
+}
+
+func (env *ChangeRequestHandler) reviewChangeRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	switch r.Method {
+	case http.MethodPut:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing change request ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid change request ID")
+			return
+		}
+
+		var review models.ChangeReview
+		err = json.NewDecoder(r.Body).Decode(&review)
+		if err != nil {
+			problem.WriteError(w, r, decodeError(err))
+			return
+		}
+
+		review.ReviewedBy = middlewares.RequestPrincipal(r).Name
+
+		// Rejections must tell the editor why
+		if err = validators.ValidateChangeReview(&review, !approve); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		if _, err = repository.GetChangeRequestByID(r.Context(), id, env.Db); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		if approve {
+			err = repository.ApproveChangeRequest(r.Context(), id, review, env.Db)
+		} else {
+			err = repository.RejectChangeRequest(r.Context(), id, review, env.Db)
+		}
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		changeRequest, err := repository.GetChangeRequestByID(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		response := map[string]interface{}{
+			"change_request": changeRequest,
+			"message":        fmt.Sprintf("Change request %d %s", id, changeRequest.Status),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
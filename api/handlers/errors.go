@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"openprogramschedule/internal/apperrors"
+	"reflect"
+)
+
+// decodeError Get the error to report for a request body that failed to decode. Values of the wrong type, such as
+// a string given for a number, are reported as invalid fields, anything else as invalid JSON
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field == "" {
+		return apperrors.Validation("invalid_json", fmt.Sprintf("Invalid JSON: %v", err))
+	}
+
+	fieldErr := apperrors.FieldError{Field: typeErr.Field, Code: "invalid_type"}
+	switch typeErr.Type.Kind() {
+	case reflect.String:
+		fieldErr.Message = typeErr.Field + " must be a string"
+	case reflect.Bool:
+		fieldErr.Message = typeErr.Field + " must be a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fieldErr.Message = typeErr.Field + " must be an integer in range"
+	case reflect.Slice:
+		fieldErr.Message = typeErr.Field + " must be a list"
+	default:
+		fieldErr.Message = typeErr.Field + " must be an object"
+	}
+	return apperrors.Invalid([]apperrors.FieldError{fieldErr})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/events"
+	"openprogramschedule/internal/problem"
+	"time"
+)
+
+type EventHandler struct {
+	Broker *events.Broker
+}
+
+// StreamEventsHandler Stream the change events as Server-Sent Events until the client disconnects
+func (env *EventHandler) StreamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+		// The stream outlives the server write timeout, which is lifted for it
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			slog.WarnContext(r.Context(), "Error while lifting the write deadline", "error", err)
+		}
+
+		subscription := env.Broker.Subscribe()
+		defer env.Broker.Unsubscribe(subscription)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-subscription:
+				data, err := json.Marshal(event)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+					continue
+				}
+				if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/db"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/workers"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout Upper bound of the database checks, so a hung database fails the probe instead of blocking it
+const readinessTimeout = 2 * time.Second
+
+const (
+	healthOk          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+type HealthHandler struct {
+	Db                *sql.DB
+	PublicationWorker *workers.PublicationWorker
+	shuttingDown      atomic.Bool
+}
+
+// HealthCheck Outcome of one dependency check, errors are logged and only summed up here as the checks are public
+type HealthCheck struct {
+	Status    string                `json:"status"`
+	LatencyMs *float64              `json:"latency_ms,omitempty"`
+	Version   *int                  `json:"version,omitempty"`
+	Expected  *int                  `json:"expected,omitempty"`
+	Worker    *workers.WorkerStatus `json:"worker,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+// HealthReport Overall status, along with the breakdown by check
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// SetShuttingDown Make the readiness check fail, so load balancers stop routing requests while the server drains
+func (env *HealthHandler) SetShuttingDown() {
+	env.shuttingDown.Store(true)
+}
+
+// LivenessHandler Report that the process is up and serving, without checking its dependencies
+func (env *HealthHandler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeHealthReport(w, r, HealthReport{Status: healthOk})
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// ReadinessHandler Report whether the server can serve requests: the database answers with the expected schema,
+// the publication worker is running and the server is not shutting down
+func (env *HealthHandler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := HealthReport{Status: healthOk, Checks: make(map[string]HealthCheck)}
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		start := time.Now()
+		database := HealthCheck{Status: healthOk}
+		if err := env.Db.PingContext(ctx); err != nil {
+			slog.WarnContext(r.Context(), "Database check failed", "error", err)
+			database.Status, database.Error = healthUnavailable, "ping failed"
+		}
+		latency := float64(time.Since(start).Microseconds()) / 1000
+		database.LatencyMs = &latency
+		report.Checks["database"] = database
+
+		expected := db.SchemaVersion
+		schema := HealthCheck{Status: healthOk, Expected: &expected}
+		if version, err := db.GetSchemaVersion(ctx, env.Db); err != nil {
+			slog.WarnContext(r.Context(), "Schema check failed", "error", err)
+			schema.Status, schema.Error = healthUnavailable, "schema version unavailable"
+		} else {
+			schema.Version = &version
+			// A newer schema is fine, migrated by an instance of the next release during a rolling deploy
+			if version < expected {
+				schema.Status = healthUnavailable
+			}
+		}
+		report.Checks["schema"] = schema
+
+		workerStatus := env.PublicationWorker.Status()
+		worker := HealthCheck{Status: healthOk, Worker: &workerStatus}
+		if !workerStatus.Healthy {
+			worker.Status = healthUnavailable
+		}
+		report.Checks["publication_worker"] = worker
+
+		shutdown := HealthCheck{Status: healthOk}
+		if env.shuttingDown.Load() {
+			shutdown.Status = healthUnavailable
+		}
+		report.Checks["shutdown"] = shutdown
+
+		for _, check := range report.Checks {
+			if check.Status != healthOk {
+				report.Status = healthUnavailable
+			}
+		}
+		writeHealthReport(w, r, report)
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func writeHealthReport(w http.ResponseWriter, r *http.Request, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == healthOk {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+	}
+}
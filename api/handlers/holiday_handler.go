@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/validators"
+	"strconv"
+)
+
+type HolidayHandler struct {
+	Db *sql.DB
+}
+
+func (env *HolidayHandler) AddHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var holidayData models.Holiday
+
+		err := json.NewDecoder(r.Body).Decode(&holidayData)
+		if err != nil {
+			problem.WriteError(w, r, decodeError(err))
+			return
+		}
+
+		if err = validators.ValidateHoliday(&holidayData); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		id, err := repository.AddHoliday(r.Context(), &holidayData, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		message := fmt.Sprintf("Added new holiday with id: %v", id)
+		response := map[string]interface{}{
+			"id":      id,
+			"message": message,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *HolidayHandler) GetAllHolidaysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		country := r.URL.Query().Get("country")
+		holidays, err := repository.GetAllHolidays(r.Context(), country, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if len(holidays) == 0 {
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No holidays found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(holidays)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *HolidayHandler) GetHolidayByIDHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing holiday ID")
+			return
+		}
+
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid holiday ID")
+			return
+		}
+
+		holiday, err := repository.GetHolidayByID(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(holiday)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *HolidayHandler) DeleteHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing holiday ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid holiday ID")
+			return
+		}
+		err = repository.DeleteHoliday(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		message := fmt.Sprintf("Deleted holiday: %v", id)
+		response := map[string]interface{}{
+			"message": message,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	}
+}
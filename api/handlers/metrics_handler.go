@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/metrics"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/resilience"
+	"sync"
+	"time"
+)
+
+// domainGaugesTTL How long the domain gauges are reused, so frequent scrapes do not count the rows of the tables each time
+const domainGaugesTTL = 30 * time.Second
+
+type MetricsHandler struct {
+	Db *sql.DB
+
+	// domainGauges The last counted domain gauges, guarded by domainMu, which also serializes concurrent counts
+	domainMu     sync.Mutex
+	domainRead   time.Time
+	domainGauges []sample
+}
+
+// sample A gauge or counter value read at scrape time
+type sample struct {
+	name  string
+	help  string
+	value float64
+}
+
+// GetMetricsHandler Expose the metrics in the Prometheus text format, along with the connection pool stats, the domain gauges and the cache sizes
+func (env *MetricsHandler) GetMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", metrics.ContentType)
+		if err := metrics.WriteAll(w); err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			return
+		}
+
+		stats := env.Db.Stats()
+		gauges := []sample{
+			{"db_open_connections", "Established connections to the database, in use or idle.", float64(stats.OpenConnections)},
+			{"db_in_use_connections", "Connections to the database currently in use.", float64(stats.InUse)},
+			{"db_idle_connections", "Idle connections to the database.", float64(stats.Idle)},
+			{"db_max_open_connections", "Maximum number of open connections to the database, 0 for unlimited.", float64(stats.MaxOpenConnections)},
+		}
+		counters := []sample{
+			{"db_wait_count_total", "Connections waited for.", float64(stats.WaitCount)},
+			{"db_wait_duration_seconds_total", "Time spent waiting for a connection.", stats.WaitDuration.Seconds()},
+			{"db_max_idle_closed_total", "Connections closed because of the idle connections limit.", float64(stats.MaxIdleClosed)},
+			{"db_max_lifetime_closed_total", "Connections closed because of their maximum lifetime.", float64(stats.MaxLifetimeClosed)},
+		}
+
+		breakerStates := map[string]float64{resilience.StateClosed: 0, resilience.StateOpen: 1, resilience.StateHalfOpen: 2}
+		gauges = append(gauges, sample{"db_circuit_breaker_state", "State of the database circuit breaker: 0 closed, 1 open, 2 half-open.",
+			breakerStates[repository.BreakerState()]})
+
+		gauges = append(gauges, env.countDomain(r)...)
+
+		for _, gauge := range gauges {
+			if err := metrics.WriteGauge(w, gauge.name, gauge.help, gauge.value); err != nil {
+				slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+				return
+			}
+		}
+		for _, counter := range counters {
+			if err := metrics.WriteCounter(w, counter.name, counter.help, counter.value); err != nil {
+				slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+				return
+			}
+		}
+
+		entries := make(map[string]float64)
+		for name, count := range repository.ReadCacheEntries() {
+			entries[name] = float64(count)
+		}
+		if err := metrics.WriteGaugeVec(w, "cache_entries", "Values held by an in-process cache, by cache.", "cache", entries); err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// countDomain Get the domain gauges, counted at most once per domainGaugesTTL. When a count fails its gauge is left out
+// and every count is run again on the next scrape
+func (env *MetricsHandler) countDomain(r *http.Request) []sample {
+	env.domainMu.Lock()
+	defer env.domainMu.Unlock()
+	if time.Since(env.domainRead) < domainGaugesTTL {
+		return env.domainGauges
+	}
+
+	var gauges []sample
+	failed := false
+	programs, err := repository.CountPrograms(r.Context(), env.Db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error during operation", "error", err)
+		failed = true
+	} else {
+		gauges = append(gauges, sample{"programs", "Programs, embargoed ones included.", float64(programs)})
+	}
+	upcoming, err := repository.CountUpcomingSchedules(r.Context(), env.Db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error during operation", "error", err)
+		failed = true
+	} else {
+		gauges = append(gauges, sample{"upcoming_schedules", "Published schedules that have not started yet.", float64(upcoming)})
+	}
+
+	if !failed {
+		env.domainRead, env.domainGauges = time.Now(), gauges
+	}
+	return gauges
+}
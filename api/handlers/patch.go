@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/patch"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// maxPatchBytes Largest patch document accepted, far above any patch of a program or schedule
+const maxPatchBytes = 64 << 10
+
+// applyPatch Apply the patch in the request body to the current record and decode the result into patched. Members
+// outside writable, such as the id or the status, must be left as they are. Bodies over maxPatchBytes are not read
+func applyPatch(w http.ResponseWriter, r *http.Request, current any, writable []string, patched any) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	if err != nil {
+		return apperrors.Validation("invalid_patch", fmt.Sprintf("Invalid patch: %v", err))
+	}
+	document, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	result, err := patch.Apply(r.Header.Get("Content-Type"), document, body)
+	if err != nil {
+		return err
+	}
+
+	var before, after map[string]any
+	if err = json.Unmarshal(document, &before); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(result, &after); err != nil {
+		return apperrors.Validation("invalid_patch", "The patched document must be an object")
+	}
+	members := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		members = append(members, name)
+	}
+	for name := range after {
+		if _, exists := before[name]; !exists {
+			members = append(members, name)
+		}
+	}
+	sort.Strings(members)
+	var fieldErrs []apperrors.FieldError
+	for _, name := range members {
+		if !slices.Contains(writable, name) && !reflect.DeepEqual(before[name], after[name]) {
+			fieldErrs = append(fieldErrs, apperrors.FieldError{Field: name, Code: "read_only", Message: name + " cannot be changed"})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		return apperrors.Invalid(fieldErrs)
+	}
+
+	if err = json.Unmarshal(result, patched); err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/patch"
+	"openprogramschedule/internal/problem"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		// readOnly Members reported as read_only, when the patch changes them
+		readOnly []string
+		// status Status the error is reported with, 0 when the patch applies
+		status int
+		want   string
+	}{
+		{name: "merge patch of a writable member", contentType: patch.MergePatchType, body: `{"name": "Late News"}`, want: "Late News"},
+		{name: "plain JSON is a merge patch", contentType: "application/json; charset=utf-8", body: `{"name": "Late News"}`, want: "Late News"},
+		{name: "JSON Patch of a writable member", contentType: patch.JSONPatchType, body: `[{"op": "replace", "path": "/name", "value": "Late News"}]`, want: "Late News"},
+		{name: "unchanged read-only member", contentType: patch.MergePatchType, body: `{"id": 7, "version": 3, "name": "Late News"}`, want: "Late News"},
+		{name: "merge patch of the id", contentType: patch.MergePatchType, body: `{"id": 8}`, readOnly: []string{"id"}, status: http.StatusBadRequest},
+		{name: "merge patch removing the version", contentType: patch.MergePatchType, body: `{"version": null}`, readOnly: []string{"version"}, status: http.StatusBadRequest},
+		{name: "JSON Patch of the version", contentType: patch.JSONPatchType, body: `[{"op": "replace", "path": "/version", "value": 4}]`, readOnly: []string{"version"}, status: http.StatusBadRequest},
+		{name: "JSON Patch adding a member", contentType: patch.JSONPatchType, body: `[{"op": "add", "path": "/rating", "value": 5}]`, readOnly: []string{"rating"}, status: http.StatusBadRequest},
+		{
+			name:        "every read-only member reported",
+			contentType: patch.JSONPatchType,
+			body:        `[{"op": "remove", "path": "/id"}, {"op": "replace", "path": "/version", "value": 4}]`,
+			readOnly:    []string{"id", "version"},
+			status:      http.StatusBadRequest,
+		},
+		{name: "failed test", contentType: patch.JSONPatchType, body: `[{"op": "test", "path": "/name", "value": "Sports"}]`, status: http.StatusConflict},
+		{name: "patched document not an object", contentType: patch.MergePatchType, body: `[]`, status: http.StatusBadRequest},
+		{name: "without a Content-Type", body: `{"name": "Late News"}`, status: http.StatusUnsupportedMediaType},
+		{name: "other media type", contentType: "text/plain", body: `{"name": "Late News"}`, status: http.StatusUnsupportedMediaType},
+		{name: "too large", contentType: patch.MergePatchType, body: `{"description": "` + strings.Repeat("a", maxPatchBytes) + `"}`, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, inProduction := uint(7), true
+			current := models.Program{Id: &id, Name: "News", Description: "Daily news", Host: "Anna", Category: "News", InProduction: &inProduction, Version: 3}
+			r := httptest.NewRequest(http.MethodPatch, "/programs/update?id=7", strings.NewReader(test.body))
+			if test.contentType != "" {
+				r.Header.Set("Content-Type", test.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			var patched models.Program
+			err := applyPatch(w, r, current, programWritable, &patched)
+			if test.status == 0 {
+				if err != nil {
+					t.Fatalf("applyPatch() error = %v, want none", err)
+				}
+				if patched.Name != test.want || *patched.Id != id || patched.Version != current.Version {
+					t.Errorf("patched = %+v, want name %q with the id and version unchanged", patched, test.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("applyPatch() error = nil, want one")
+			}
+			problem.WriteError(w, r, err)
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d", w.Code, test.status)
+			}
+
+			var appErr *apperrors.Error
+			var readOnly []string
+			if errors.As(err, &appErr) {
+				for _, field := range appErr.Fields {
+					if field.Code == "read_only" {
+						readOnly = append(readOnly, field.Field)
+					}
+				}
+			}
+			if strings.Join(readOnly, ",") != strings.Join(test.readOnly, ",") {
+				t.Errorf("read_only fields = %v, want %v", readOnly, test.readOnly)
+			}
+		})
+	}
+}
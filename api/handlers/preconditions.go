@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"openprogramschedule/internal/problem"
+	"strconv"
+	"strings"
+)
+
+// etag Get the strong entity tag of a row version
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// ifMatch Get the row version a write requires from its If-Match header, 0 when any version will do: with * or, unless
+// required, without the header. The data tag the ETag of a read ends with, after the version, is ignored. Weak tags
+// never match, as If-Match compares tags strongly. On failure the problem is written and ok is false
+func ifMatch(w http.ResponseWriter, r *http.Request, required bool) (version uint64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case header == "" && required:
+		problem.Write(w, r, http.StatusPreconditionRequired, "precondition_required", "If-Match is required, with the ETag of the resource")
+		return 0, false
+	case header == "" || header == "*":
+		return 0, true
+	case strings.HasPrefix(header, "W/"):
+		problem.Write(w, r, http.StatusPreconditionFailed, "version_mismatch", "If-Match needs a strong ETag")
+		return 0, false
+	}
+
+	value, found := strings.CutPrefix(header, `"`)
+	value, closed := strings.CutSuffix(value, `"`)
+	value, _, _ = strings.Cut(value, "-")
+	version, err := strconv.ParseUint(value, 10, 64)
+	if !found || !closed || err != nil || version == 0 {
+		problem.Write(w, r, http.StatusBadRequest, "invalid_if_match", "If-Match must be * or a single ETag of the resource")
+		return 0, false
+	}
+	return version, true
+}
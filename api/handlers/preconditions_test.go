@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		required bool
+		want     uint64
+		// status Status of the problem written, 0 when the header is accepted
+		status int
+	}{
+		{name: "missing", header: "", want: 0},
+		{name: "missing when required", header: "", required: true, status: http.StatusPreconditionRequired},
+		{name: "any version", header: "*", want: 0},
+		{name: "any version when required", header: "*", required: true, want: 0},
+		{name: "version", header: `"42"`, want: 42},
+		{name: "surrounding spaces", header: `  "42" `, want: 42},
+		{name: "data tag of a read ignored", header: `"42-1a2b3c"`, want: 42},
+		{name: "weak tag", header: `W/"42"`, status: http.StatusPreconditionFailed},
+		{name: "unquoted", header: "42", status: http.StatusBadRequest},
+		{name: "unclosed", header: `"42`, status: http.StatusBadRequest},
+		{name: "not a version", header: `"abc"`, status: http.StatusBadRequest},
+		{name: "zero version", header: `"0"`, status: http.StatusBadRequest},
+		{name: "negative version", header: `"-1"`, status: http.StatusBadRequest},
+		{name: "several tags", header: `"42", "43"`, status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/programs/update?id=1", nil)
+			if test.header != "" {
+				r.Header.Set("If-Match", test.header)
+			}
+			w := httptest.NewRecorder()
+
+			version, ok := ifMatch(w, r, test.required)
+			if ok != (test.status == 0) {
+				t.Fatalf("ifMatch(%q) ok = %v, want %v", test.header, ok, test.status == 0)
+			}
+			if !ok {
+				if w.Code != test.status {
+					t.Errorf("ifMatch(%q) status = %d, want %d", test.header, w.Code, test.status)
+				}
+				return
+			}
+			if version != test.want {
+				t.Errorf("ifMatch(%q) = %d, want %d", test.header, version, test.want)
+			}
+		})
+	}
+}
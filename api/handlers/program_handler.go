@@ -3,12 +3,13 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"openprogramschedule/internal/middlewares"
 	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
 	"openprogramschedule/internal/repository"
 	"openprogramschedule/internal/validators"
 	"strconv"
@@ -16,6 +17,8 @@ import (
 
 type ProgramHandler struct {
 	Db *sql.DB
+	// RequireIfMatch Reject the writes without If-Match, instead of applying them to any version
+	RequireIfMatch bool
 }
 
 func (env *ProgramHandler) AddProgramHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,19 +28,18 @@ func (env *ProgramHandler) AddProgramHandler(w http.ResponseWriter, r *http.Requ
 
 		err := json.NewDecoder(r.Body).Decode(&programData)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			problem.WriteError(w, r, decodeError(err))
 			return
 		}
 
 		if err = validators.ValidateProgram(&programData); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.WriteError(w, r, err)
 			return
 		}
 
-		id, err := repository.AddProgram(&programData, env.Db)
+		id, err := repository.AddProgram(r.Context(), &programData, env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
@@ -52,13 +54,13 @@ func (env *ProgramHandler) AddProgramHandler(w http.ResponseWriter, r *http.Requ
 
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 
 	default:
-		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -67,43 +69,34 @@ func (env *ProgramHandler) GetProgramByIDHandler(w http.ResponseWriter, r *http.
 	case http.MethodGet:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program ID")
 			return
 		}
 
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
 			return
 		}
 
-		program, err := repository.GetProgramByID(id, env.Db)
+		program, err := repository.GetProgramByID(r.Context(), id, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			if err.Error() == "program not found" {
-				http.Error(w, "Program not found: invalid ID", http.StatusNotFound)
-				return
-			}
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(program.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(program)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -112,32 +105,28 @@ func (env *ProgramHandler) GetProgramByNameHandler(w http.ResponseWriter, r *htt
 	case http.MethodGet:
 		name := r.URL.Query().Get("name")
 		if name == "" {
-			http.Error(w, "Missing program name", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program name")
 			return
 		}
 
-		program, err := repository.GetProgramByName(name, env.Db)
+		program, err := repository.GetProgramByName(r.Context(), name, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			if err.Error() == "program not found" {
-				http.Error(w, "Program not found", http.StatusNotFound)
-				return
-			}
-			log.Printf("Error during program retrieval: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(program.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(program)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 
 	default:
-		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -146,14 +135,13 @@ func (env *ProgramHandler) GetProgramsByCategoryHandler(w http.ResponseWriter, r
 	case http.MethodGet:
 		category := r.URL.Query().Get("category")
 		if category == "" {
-			http.Error(w, "Missing category parameter", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing category parameter")
 			return
 		}
-		log.Printf("Received category: '%s'", category)
-		programs, err := repository.GetProgramsByCategory(category, env.Db)
+		slog.DebugContext(r.Context(), "Received category", "category", category)
+		programs, err := repository.GetProgramsByCategory(r.Context(), category, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during programs retrieval: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
@@ -161,44 +149,38 @@ func (env *ProgramHandler) GetProgramsByCategoryHandler(w http.ResponseWriter, r
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(programs)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 
 	default:
-		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
 func (env *ProgramHandler) GetAllProgramsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		programs, err := repository.GetAllPrograms(env.Db)
+		programs, err := repository.GetAllPrograms(r.Context(), !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		if len(programs) == 0 {
-			http.Error(w, "No programs found", http.StatusNotFound)
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No programs found")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(programs)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -207,40 +189,45 @@ func (env *ProgramHandler) UpdateProgramHandler(w http.ResponseWriter, r *http.R
 	case http.MethodPut:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program ID")
 			return
 		}
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
+			return
+		}
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
 			return
 		}
 
 		var updatedProgram models.Program
 		err = json.NewDecoder(r.Body).Decode(&updatedProgram)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			problem.WriteError(w, r, decodeError(err))
 			return
 		}
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
 			if err != nil {
-				log.Println("Error during body close:", err)
+				slog.ErrorContext(r.Context(), "Error during body close", "error", err)
 			}
 		}(r.Body)
 
 		if err = validators.ValidateProgram(&updatedProgram); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.WriteError(w, r, err)
 			return
 		}
 
-		err = repository.UpdateProgramByID(id, updatedProgram, env.Db)
+		updatedProgram.Version, err = repository.UpdateProgramByID(r.Context(), id, updatedProgram, version, env.Db)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(updatedProgram.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		updatedProgram.Id = new(uint)
@@ -251,12 +238,87 @@ func (env *ProgramHandler) UpdateProgramHandler(w http.ResponseWriter, r *http.R
 		}
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// programWritable Members of a program a patch can change
+var programWritable = []string{"name", "description", "host", "category", "in_production", "publish_at"}
+
+func (env *ProgramHandler) PatchProgramHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPatch:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program ID")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
+			return
+		}
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
+			return
+		}
+
+		currentProgram, err := repository.GetProgramByID(r.Context(), id, false, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if version != 0 && version != currentProgram.Version {
+			problem.WriteError(w, r, repository.VersionMismatch())
+			return
+		}
+
+		var patchedProgram models.Program
+		if err = applyPatch(w, r, currentProgram, programWritable, &patchedProgram); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		if err = validators.ValidateProgram(&patchedProgram); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		patched, err := repository.PatchProgramByID(r.Context(), id, *currentProgram, patchedProgram, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		// Nothing was written, the resource is still the one its ETag tells
+		if len(patched.Changed) == 0 {
+			w.Header().Set("ETag", etag(patched.Version))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		patchedProgram.Version = patched.Version
+
+		w.Header().Set("ETag", etag(patchedProgram.Version))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		response := map[string]interface{}{
+			"program": patchedProgram,
+			"changed": patched.Changed,
+			"message": "Patch successful",
+		}
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -265,29 +327,27 @@ func (env *ProgramHandler) DeleteProgramHandler(w http.ResponseWriter, r *http.R
 	case http.MethodDelete:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program ID")
 			return
 		}
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
 			return
 		}
-		_, err = repository.GetProgramByID(id, env.Db)
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
+			return
+		}
+		_, err = repository.GetProgramByID(r.Context(), id, false, env.Db)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				http.Error(w, "Program not found", http.StatusNotFound)
-			} else {
-				log.Printf("Error fetching program: %v", err)
-				http.Error(w, "Failed to fetch program", http.StatusInternalServerError)
-			}
+			problem.WriteError(w, r, err)
 			return
 		}
-		err = repository.DeleteProgram(id, env.Db)
+		err = repository.DeleteProgram(r.Context(), id, version, env.Db)
 		if err != nil {
-			log.Printf("Error deleting program: %v", err)
-			http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		msg := fmt.Sprintf("Program with id %d deleted successfully", id)
@@ -298,8 +358,8 @@ func (env *ProgramHandler) DeleteProgramHandler(w http.ResponseWriter, r *http.R
 		w.Header().Set("Content-Type", "application/json")
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 	}
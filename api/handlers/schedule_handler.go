@@ -5,16 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/middlewares"
 	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
 	"openprogramschedule/internal/repository"
 	"openprogramschedule/internal/validators"
+	"slices"
 	"strconv"
+	"time"
 )
 
 type ScheduleHandler struct {
 	Db *sql.DB
+	// HolidayCountry and HolidayRegion Holiday calendar of the deployment, used when a request names none
+	HolidayCountry string
+	HolidayRegion  string
+	// RequireIfMatch Reject the writes without If-Match, instead of applying them to any version
+	RequireIfMatch bool
 }
 
 func (env *ScheduleHandler) AddScheduleHandler(w http.ResponseWriter, r *http.Request) {
@@ -24,19 +34,18 @@ func (env *ScheduleHandler) AddScheduleHandler(w http.ResponseWriter, r *http.Re
 
 		err := json.NewDecoder(r.Body).Decode(&scheduleData)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("JSON Error: %v", err), http.StatusBadRequest)
+			problem.WriteError(w, r, decodeError(err))
 			return
 		}
 
 		if err = validators.ValidateSchedule(&scheduleData); err != nil {
-			http.Error(w, fmt.Sprintf("Validation Error: %v", err), http.StatusBadRequest)
+			problem.WriteError(w, r, err)
 			return
 		}
 
-		id, err := repository.AddSchedule(&scheduleData, env.Db)
+		id, err := repository.AddSchedule(r.Context(), &scheduleData, env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
@@ -51,45 +60,115 @@ func (env *ScheduleHandler) AddScheduleHandler(w http.ResponseWriter, r *http.Re
 
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 
 	default:
-		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ScheduleHandler) AddScheduleOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var overrideData models.Schedule
+
+		err := json.NewDecoder(r.Body).Decode(&overrideData)
+		if err != nil {
+			problem.WriteError(w, r, decodeError(err))
+			return
+		}
+
+		if err = validators.ValidateScheduleOverride(&overrideData); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		id, err := repository.AddScheduleOverride(r.Context(), &overrideData, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		preempted, err := repository.GetSchedulesPreemptedBy(r.Context(), id, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		message := fmt.Sprintf("Added new schedule override with id: %v, preempting %d schedules", id, len(preempted))
+		response := map[string]interface{}{
+			"id":        id,
+			"preempted": preempted,
+			"message":   message,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ScheduleHandler) GetScheduleOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		overrides, err := repository.GetScheduleOverrides(r.Context(), !middlewares.IsPrivateRequest(r), env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if len(overrides) == 0 {
+			slog.InfoContext(r.Context(), "No results found")
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No results found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(overrides)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
 func (env *ScheduleHandler) GetAllSchedulesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		schedules, err := repository.GetAllSchedules(env.Db)
+		schedules, err := repository.GetAllSchedules(r.Context(), !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		if len(schedules) == 0 {
-			log.Printf("No results found")
-			http.Error(w, "No results found", http.StatusNotFound)
+			slog.InfoContext(r.Context(), "No results found")
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No results found")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(schedules)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -98,43 +177,34 @@ func (env *ScheduleHandler) GetScheduleByIDHandler(w http.ResponseWriter, r *htt
 	case http.MethodGet:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing schedule ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing schedule ID")
 			return
 		}
 
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid schedule ID")
 			return
 		}
 
-		program, err := repository.GetScheduleByID(id, env.Db)
+		program, err := repository.GetScheduleByID(r.Context(), id, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			if err.Error() == "schedule not found" {
-				http.Error(w, "Schedule not found: invalid ID", http.StatusNotFound)
-				return
-			}
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(program.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(program)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -143,42 +213,49 @@ func (env *ScheduleHandler) GetScheduleByProgramIdHandler(w http.ResponseWriter,
 	case http.MethodGet:
 		programIdStr := r.URL.Query().Get("programId")
 		if programIdStr == "" {
-			http.Error(w, "Missing program id", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing program id")
 			return
 		}
 		programIdInt, err := strconv.Atoi(programIdStr)
 		programId := uint(programIdInt)
 		if err != nil {
-			http.Error(w, "Invalid program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
 			return
 		}
-		schedules, err := repository.GetScheduleByProgramID(programId, env.Db)
+		schedules, err := repository.GetScheduleByProgramID(r.Context(), programId, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		if len(*schedules) == 0 {
-			log.Printf("No results found")
-			http.Error(w, "No results found", http.StatusNotFound)
+			slog.InfoContext(r.Context(), "No results found")
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No results found")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(schedules)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// holidayCalendar Get the country and region whose holidays apply to a request, defaulting to the deployment ones
+func (env *ScheduleHandler) holidayCalendar(r *http.Request) (string, string) {
+	country := r.URL.Query().Get("country")
+	if country == "" {
+		country = env.HolidayCountry
+	}
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = env.HolidayRegion
 	}
+	return country, region
 }
 
 func (env *ScheduleHandler) GetScheduleByDayHandler(w http.ResponseWriter, r *http.Request) {
@@ -186,44 +263,39 @@ func (env *ScheduleHandler) GetScheduleByDayHandler(w http.ResponseWriter, r *ht
 	case http.MethodGet:
 		dayStr := r.URL.Query().Get("day")
 		if dayStr == "" {
-			http.Error(w, "Missing day", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing day")
 			return
 		}
 		day, err := strconv.Atoi(dayStr)
 		if err != nil {
-			http.Error(w, "Invalid day", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid day")
 			return
 		}
 		if day > 7 || day < 1 {
-			http.Error(w, "Day must be between 1 and 7", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Day must be between 1 and 7")
 			return
 		}
-		schedules, err := repository.GetScheduleByDay(day, env.Db)
+		country, region := env.holidayCalendar(r)
+		schedules, err := repository.GetScheduleByDay(r.Context(), day, country, region, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		if len(*schedules) == 0 {
-			log.Printf("No schedules found for day: %v", day)
-			http.Error(w, "No schedule found for this day", http.StatusNotFound)
+			slog.InfoContext(r.Context(), "No schedules found for day", "day", day)
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No schedule found for this day")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(schedules)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -232,36 +304,31 @@ func (env *ScheduleHandler) GetScheduleByDateHandler(w http.ResponseWriter, r *h
 	case http.MethodGet:
 		dayStr := r.URL.Query().Get("date")
 		if dayStr == "" {
-			http.Error(w, "Missing day", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing day")
 			return
 		}
 
-		schedules, err := repository.GetScheduleByDate(dayStr, env.Db)
+		country, region := env.holidayCalendar(r)
+		schedules, err := repository.GetScheduleByDate(r.Context(), dayStr, country, region, !middlewares.IsPrivateRequest(r), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		if len(*schedules) == 0 {
-			log.Printf("No schedules found for day: %v", dayStr)
-			http.Error(w, "No schedule found for this day", http.StatusBadRequest)
+			slog.InfoContext(r.Context(), "No schedules found for day", "day", dayStr)
+			problem.Write(w, r, http.StatusNotFound, "no_results", "No schedule found for this day")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(schedules)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
-	case http.MethodOptions:
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -270,41 +337,64 @@ func (env *ScheduleHandler) UpdateScheduleHandler(w http.ResponseWriter, r *http
 	case http.MethodPut:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing id", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing id")
 			return
 		}
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid schedule ID")
+			return
+		}
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
 			return
 		}
 
 		var updatedSchedule models.Schedule
 		err = json.NewDecoder(r.Body).Decode(&updatedSchedule)
 		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.WriteError(w, r, decodeError(err))
 			return
 		}
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
 			if err != nil {
-				log.Printf("Error closing body: %v", err)
+				slog.ErrorContext(r.Context(), "Error closing body", "error", err)
 			}
 		}(r.Body)
 
-		if err = validators.ValidateSchedule(&updatedSchedule); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		// The status has its own endpoint, a status sent here would be silently dropped
+		if updatedSchedule.Status != "" {
+			problem.WriteError(w, r, apperrors.Invalid([]apperrors.FieldError{
+				{Field: "status", Code: "read_only", Message: "status is changed with /schedules/update-status"},
+			}))
+			return
+		}
+		// Whether the schedule is an override is read-only, its end date and reason are only written to overrides
+		currentSchedule, err := repository.GetScheduleByID(r.Context(), id, false, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		updatedSchedule.IsOverride = currentSchedule.IsOverride
+		if updatedSchedule.IsOverride {
+			err = validators.ValidateScheduleOverride(&updatedSchedule)
+		} else {
+			err = validators.ValidateSchedule(&updatedSchedule)
+		}
+		if err != nil {
+			problem.WriteError(w, r, err)
 			return
 		}
 
-		err = repository.UpdateScheduleByID(id, updatedSchedule, env.Db)
+		updatedSchedule.Version, err = repository.UpdateScheduleByID(r.Context(), id, updatedSchedule, version, env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.WriteError(w, r, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(updatedSchedule.Version))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
@@ -316,12 +406,217 @@ func (env *ScheduleHandler) UpdateScheduleHandler(w http.ResponseWriter, r *http
 		}
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// scheduleWritable Members of a schedule a patch can change, overrides adding overrideWritable. The status has its own
+// endpoint
+var (
+	scheduleWritable = []string{"program_id", "description", "day", "date", "publish_at"}
+	overrideWritable = []string{"end_date", "override_reason"}
+)
+
+func (env *ScheduleHandler) PatchScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPatch:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing id")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid schedule ID")
+			return
+		}
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
+			return
+		}
+
+		currentSchedule, err := repository.GetScheduleByID(r.Context(), id, false, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if version != 0 && version != currentSchedule.Version {
+			problem.WriteError(w, r, repository.VersionMismatch())
+			return
+		}
+
+		writable := scheduleWritable
+		if currentSchedule.IsOverride {
+			writable = append(slices.Clip(scheduleWritable), overrideWritable...)
+		}
+		var patchedSchedule models.Schedule
+		if err = applyPatch(w, r, currentSchedule, writable, &patchedSchedule); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		// The status is read-only here and may be past the ones a new schedule can have
+		validated := patchedSchedule
+		validated.Status = ""
+		if patchedSchedule.IsOverride {
+			err = validators.ValidateScheduleOverride(&validated)
+		} else {
+			err = validators.ValidateSchedule(&validated)
+		}
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		patched, err := repository.PatchScheduleByID(r.Context(), id, *currentSchedule, patchedSchedule, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		// Nothing was written, the resource is still the one its ETag tells
+		if len(patched.Changed) == 0 {
+			w.Header().Set("ETag", etag(patched.Version))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		patchedSchedule.Version = patched.Version
+
+		w.Header().Set("ETag", etag(patchedSchedule.Version))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		response := map[string]interface{}{
+			"schedule": patchedSchedule,
+			"changed":  patched.Changed,
+			"message":  "Patch successful",
+		}
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ScheduleHandler) UpdateScheduleStatusHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing id")
+			return
+		}
+		idInt, err := strconv.Atoi(idStr)
+		id := uint(idInt)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid schedule ID")
+			return
+		}
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing status")
+			return
+		}
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
+			return
+		}
+
+		schedule, err := repository.GetScheduleByID(r.Context(), id, false, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if version != 0 && version != schedule.Version {
+			problem.WriteError(w, r, repository.VersionMismatch())
+			return
+		}
+
+		if err = validators.ValidateScheduleStatusTransition(schedule.Status, status); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		newVersion, err := repository.UpdateScheduleStatus(r.Context(), id, schedule.Status, status, version, env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		message := fmt.Sprintf("Schedule %d moved from %s to %s", id, schedule.Status, status)
+		schedule.Status = status
+		schedule.Version = newVersion
+		response := map[string]interface{}{
+			"schedule": schedule,
+			"message":  message,
+		}
+		w.Header().Set("ETag", etag(schedule.Version))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (env *ScheduleHandler) PublishScheduleRangeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		fromStr := r.URL.Query().Get("from")
+		toStr := r.URL.Query().Get("to")
+		if fromStr == "" || toStr == "" {
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing from or to date")
+			return
+		}
+		from, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+		to, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		if to.Before(from) {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "The to date must not be before the from date")
+			return
+		}
+
+		// The to date is inclusive, so the whole day is published
+		published, err := repository.PublishScheduleRange(r.Context(), from, to.AddDate(0, 0, 1), env.Db)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"published": published,
+			"message":   fmt.Sprintf("Published %d schedules from %s to %s", published, fromStr, toStr),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	}
 }
 
@@ -330,31 +625,38 @@ func (env *ScheduleHandler) DeleteScheduleHandler(w http.ResponseWriter, r *http
 	case http.MethodDelete:
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "Missing id", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "missing_parameter", "Missing id")
 			return
 		}
 		idInt, err := strconv.Atoi(idStr)
 		id := uint(idInt)
 		if err != nil {
-			http.Error(w, "Invalid program ID", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, "invalid_parameter", "Invalid program ID")
 			return
 		}
-		err = repository.DeleteScheduleByID(id, env.Db)
+		version, ok := ifMatch(w, r, env.RequireIfMatch)
+		if !ok {
+			return
+		}
+		// Schedules preempted by an override are restored as soon as it is deleted, unless another one preempts them
+		restored, err := repository.DeleteScheduleByID(r.Context(), id, version, env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		message := fmt.Sprintf("Deleted schedule: %v", id)
 		response := map[string]interface{}{
 			"message": message,
 		}
+		if len(restored) > 0 {
+			response["restored"] = restored
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 	}
@@ -363,10 +665,9 @@ func (env *ScheduleHandler) DeleteScheduleHandler(w http.ResponseWriter, r *http
 func (env *ScheduleHandler) DeleteAllSchedulesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
-		err := repository.DeleteAllSchedules(env.Db)
+		err := repository.DeleteAllSchedules(r.Context(), env.Db)
 		if err != nil {
-			log.Printf("Error during operation: %v", err)
-			http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 		response := map[string]interface{}{
@@ -376,8 +677,8 @@ func (env *ScheduleHandler) DeleteAllSchedulesHandler(w http.ResponseWriter, r *
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Println("Error during encoding:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
 			return
 		}
 	}
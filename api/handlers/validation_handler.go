@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/validators"
+)
+
+type ValidationHandler struct{}
+
+// GetRulesHandler Serve the active validation rules of each model and the enabled checks, so clients can check their input before sending it
+func (env *ValidationHandler) GetRulesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(validators.ActiveRules())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+
+	default:
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
@@ -1,28 +1,113 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"openprogramschedule/api/handlers"
+	"openprogramschedule/internal/middlewares"
+	"openprogramschedule/internal/models"
+	"slices"
+	"strings"
 )
 
-func ProgramRouter(router *http.ServeMux, env *handlers.ProgramHandler) {
-	router.HandleFunc("POST /programs/add", env.AddProgramHandler)
-	router.HandleFunc("GET /programs/get-by-id", env.GetProgramByIDHandler)              // /programs/get-by-id?id
-	router.HandleFunc("GET /programs/get-by-name", env.GetProgramByNameHandler)          // /programs/get-by-name?name
-	router.HandleFunc("GET /programs/get-by-category", env.GetProgramsByCategoryHandler) // /programs/get-by-category?category
-	router.HandleFunc("GET /programs/all", env.GetAllProgramsHandler)
-	router.HandleFunc("PUT /programs/update", env.UpdateProgramHandler)          // /programs/update?id
-	router.HandleFunc("DELETE /programs/delete-by-id", env.DeleteProgramHandler) // /programs/delete-by-id?id
-}
-
-func ScheduleRouter(router *http.ServeMux, env *handlers.ScheduleHandler) {
-	router.HandleFunc("POST /schedules/add", env.AddScheduleHandler)
-	router.HandleFunc("GET /schedules/all", env.GetAllSchedulesHandler)
-	router.HandleFunc("GET /schedules/get-by-id", env.GetScheduleByIDHandler)                // /schedules/get-by-id?id
-	router.HandleFunc("GET /schedules/get-by-program-id", env.GetScheduleByProgramIdHandler) // /schedules/get-by-program-id?programId
-	router.HandleFunc("GET /schedules/get-by-day", env.GetScheduleByDayHandler)              // /schedules/get-by-day?day
-	router.HandleFunc("GET /schedules/get-by-date", env.GetScheduleByDateHandler)            // /schedules/get-by-date?date
-	router.HandleFunc("PUT /schedules/update", env.UpdateScheduleHandler)                    // /schedules/update?id
-	router.HandleFunc("DELETE /schedules/delete-by-id", env.DeleteScheduleHandler)           // /schedules/delete-by-id?id
-	router.HandleFunc("DELETE /schedules/delete-all", env.DeleteAllSchedulesHandler)
+// Router Register each route along with the scope required to call it, so routing and authorization share one source of truth
+type Router struct {
+	mux      *http.ServeMux
+	policies middlewares.Policies
+	errs     []error
+}
+
+func NewRouter(mux *http.ServeMux) *Router {
+	return &Router{
+		mux:      mux,
+		policies: middlewares.Policies{},
+	}
+}
+
+// HandleFunc Register a "METHOD /path" pattern, scope is a models scope or middlewares.Anonymous
+func (router *Router) HandleFunc(pattern string, scope string, handler http.HandlerFunc) {
+	method, _, found := strings.Cut(pattern, " ")
+	switch {
+	case !found || method == "" || strings.HasPrefix(method, "/"):
+		router.errs = append(router.errs, fmt.Errorf("route %q lacks a method", pattern))
+	case scope == "":
+		router.errs = append(router.errs, fmt.Errorf("route %q lacks a policy", pattern))
+	case scope != middlewares.Anonymous && !slices.Contains(models.Scopes, scope):
+		router.errs = append(router.errs, fmt.Errorf("route %q has unknown scope %q", pattern, scope))
+	}
+	router.policies[pattern] = scope
+	router.mux.HandleFunc(pattern, handler)
+}
+
+// Policies Get the scope of every registered route, failing if any route was registered without a valid policy
+func (router *Router) Policies() (middlewares.Policies, error) {
+	return router.policies, errors.Join(router.errs...)
+}
+
+func ProgramRouter(router *Router, env *handlers.ProgramHandler) {
+	router.HandleFunc("POST /programs/add", models.ScopeWritePrograms, env.AddProgramHandler)
+	router.HandleFunc("GET /programs/get-by-id", models.ScopeReadPrograms, env.GetProgramByIDHandler)              // /programs/get-by-id?id
+	router.HandleFunc("GET /programs/get-by-name", models.ScopeReadPrograms, env.GetProgramByNameHandler)          // /programs/get-by-name?name
+	router.HandleFunc("GET /programs/get-by-category", models.ScopeReadPrograms, env.GetProgramsByCategoryHandler) // /programs/get-by-category?category
+	router.HandleFunc("GET /programs/all", models.ScopeReadPrograms, env.GetAllProgramsHandler)
+	router.HandleFunc("PUT /programs/update", models.ScopeWritePrograms, env.UpdateProgramHandler)          // /programs/update?id
+	router.HandleFunc("PATCH /programs/update", models.ScopeWritePrograms, env.PatchProgramHandler)         // /programs/update?id
+	router.HandleFunc("DELETE /programs/delete-by-id", models.ScopeWritePrograms, env.DeleteProgramHandler) // /programs/delete-by-id?id
+}
+
+func ScheduleRouter(router *Router, env *handlers.ScheduleHandler) {
+	router.HandleFunc("POST /schedules/add", models.ScopeWriteSchedules, env.AddScheduleHandler)
+	router.HandleFunc("POST /schedules/add-override", models.ScopeWriteSchedules, env.AddScheduleOverrideHandler)
+	router.HandleFunc("GET /schedules/overrides", models.ScopeReadSchedules, env.GetScheduleOverridesHandler)
+	router.HandleFunc("GET /schedules/all", models.ScopeReadSchedules, env.GetAllSchedulesHandler)
+	router.HandleFunc("GET /schedules/get-by-id", models.ScopeReadSchedules, env.GetScheduleByIDHandler)                // /schedules/get-by-id?id
+	router.HandleFunc("GET /schedules/get-by-program-id", models.ScopeReadSchedules, env.GetScheduleByProgramIdHandler) // /schedules/get-by-program-id?programId
+	router.HandleFunc("GET /schedules/get-by-day", models.ScopeReadSchedules, env.GetScheduleByDayHandler)              // /schedules/get-by-day?day
+	router.HandleFunc("GET /schedules/get-by-date", models.ScopeReadSchedules, env.GetScheduleByDateHandler)            // /schedules/get-by-date?date&country&region
+	router.HandleFunc("PUT /schedules/update", models.ScopeWriteSchedules, env.UpdateScheduleHandler)                   // /schedules/update?id
+	router.HandleFunc("PATCH /schedules/update", models.ScopeWriteSchedules, env.PatchScheduleHandler)                  // /schedules/update?id
+	router.HandleFunc("PUT /schedules/update-status", models.ScopeWriteSchedules, env.UpdateScheduleStatusHandler)      // /schedules/update-status?id&status
+	router.HandleFunc("POST /schedules/publish-range", models.ScopeWriteSchedules, env.PublishScheduleRangeHandler)     // /schedules/publish-range?from&to
+	router.HandleFunc("DELETE /schedules/delete-by-id", models.ScopeWriteSchedules, env.DeleteScheduleHandler)          // /schedules/delete-by-id?id
+	router.HandleFunc("DELETE /schedules/delete-all", models.ScopeWriteSchedules, env.DeleteAllSchedulesHandler)
+}
+
+func HolidayRouter(router *Router, env *handlers.HolidayHandler) {
+	router.HandleFunc("POST /holidays/add", models.ScopeWriteHolidays, env.AddHolidayHandler)
+	router.HandleFunc("GET /holidays/all", models.ScopeReadSchedules, env.GetAllHolidaysHandler)            // /holidays/all?country
+	router.HandleFunc("GET /holidays/get-by-id", models.ScopeReadSchedules, env.GetHolidayByIDHandler)      // /holidays/get-by-id?id
+	router.HandleFunc("DELETE /holidays/delete-by-id", models.ScopeWriteHolidays, env.DeleteHolidayHandler) // /holidays/delete-by-id?id
+}
+
+func EventRouter(router *Router, env *handlers.EventHandler) {
+	router.HandleFunc("GET /events", models.ScopeReadSchedules, env.StreamEventsHandler)
+}
+
+func ChangeRequestRouter(router *Router, env *handlers.ChangeRequestHandler) {
+	router.HandleFunc("POST /change-requests/submit", models.ScopeSubmitChanges, env.SubmitChangeRequestHandler)
+	router.HandleFunc("GET /change-requests/all", models.ScopeSubmitChanges, env.GetAllChangeRequestsHandler)       // /change-requests/all?status
+	router.HandleFunc("GET /change-requests/get-by-id", models.ScopeSubmitChanges, env.GetChangeRequestByIDHandler) // /change-requests/get-by-id?id
+	router.HandleFunc("PUT /change-requests/approve", models.ScopeReviewChanges, env.ApproveChangeRequestHandler)   // /change-requests/approve?id
+	router.HandleFunc("PUT /change-requests/reject", models.ScopeReviewChanges, env.RejectChangeRequestHandler)     // /change-requests/reject?id
+}
+
+func ApiKeyRouter(router *Router, env *handlers.ApiKeyHandler) {
+	router.HandleFunc("POST /api-keys/add", models.ScopeAdmin, env.AddApiKeyHandler)
+	router.HandleFunc("GET /api-keys/all", models.ScopeAdmin, env.GetAllApiKeysHandler)
+	router.HandleFunc("POST /api-keys/rotate", models.ScopeAdmin, env.RotateApiKeyHandler) // /api-keys/rotate?id&grace
+	router.HandleFunc("PUT /api-keys/revoke", models.ScopeAdmin, env.RevokeApiKeyHandler)  // /api-keys/revoke?id
+}
+
+func MetricsRouter(router *Router, env *handlers.MetricsHandler) {
+	router.HandleFunc("GET /metrics", models.ScopeReadMetrics, env.GetMetricsHandler)
+}
+
+func ValidationRouter(router *Router, env *handlers.ValidationHandler) {
+	router.HandleFunc("GET /validation/rules", middlewares.Anonymous, env.GetRulesHandler)
+}
+
+func HealthRouter(router *Router, env *handlers.HealthHandler) {
+	router.HandleFunc("GET /healthz", middlewares.Anonymous, env.LivenessHandler)
+	router.HandleFunc("GET /readyz", middlewares.Anonymous, env.ReadinessHandler)
 }
@@ -3,33 +3,130 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"github.com/joho/godotenv"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"openprogramschedule/api/handlers"
 	"openprogramschedule/api/routes"
+	"openprogramschedule/internal/config"
 	"openprogramschedule/internal/db"
+	"openprogramschedule/internal/events"
+	"openprogramschedule/internal/logging"
 	"openprogramschedule/internal/middlewares"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/ratelimit"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/resilience"
+	"openprogramschedule/internal/tlsconfig"
+	"openprogramschedule/internal/validators"
+	"openprogramschedule/internal/workers"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
-func main() {
+// loadConfig Load the configuration from the .env file, the environment and args, exiting on invalid settings.
+// Logs are written to logOutput
+func loadConfig(args []string, logOutput io.Writer) config.Config {
+	envErr := godotenv.Load()
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if err = logging.Setup(logOutput, cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found")
+	}
+	return cfg
+}
 
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+func main() {
+	// config print: show the effective configuration, secrets redacted, without starting the server
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		cfg := loadConfig(os.Args[3:], os.Stderr)
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	cfg := loadConfig(os.Args[1:], os.Stdout)
 
-	database := db.ConnectDB()
+	database := db.ConnectDB(cfg.Database)
+	queryTimeouts := make(map[string]time.Duration, len(cfg.Database.QueryTimeouts))
+	for function, timeout := range cfg.Database.QueryTimeouts {
+		if !repository.IsOperation(function) {
+			log.Fatalf("Invalid query timeouts: unknown repository function %q", function)
+		}
+		queryTimeouts[function] = time.Duration(timeout)
+	}
+	repository.SetTimeouts(repository.Timeouts{
+		Read:       time.Duration(cfg.Database.ReadTimeout),
+		Write:      time.Duration(cfg.Database.WriteTimeout),
+		Operations: queryTimeouts,
+	})
+	repository.SetRetries(repository.Retries{
+		MaxAttempts: cfg.Database.RetryMaxAttempts,
+		Backoff: resilience.Backoff{
+			BaseDelay: time.Duration(cfg.Database.RetryBaseDelay),
+			MaxDelay:  time.Duration(cfg.Database.RetryMaxDelay),
+		},
+		BreakerThreshold: cfg.Database.BreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.Database.BreakerCooldown),
+	})
+	repository.SetReadCache(repository.ReadCache{
+		TTL:        time.Duration(cfg.Database.CacheTTL),
+		MaxEntries: cfg.Database.CacheMaxEntries,
+	})
+	ruleSet, err := validators.NewRuleSet(cfg.Validation.Rules, cfg.Validation.Checks)
+	if err != nil {
+		log.Fatalf("Invalid validation rules:\n%v", err)
+	}
+	validators.SetRules(ruleSet)
 
 	programEnv := &handlers.ProgramHandler{
-		Db: database,
+		Db:             database,
+		RequireIfMatch: cfg.Server.RequireIfMatch,
 	}
 	scheduleEnv := &handlers.ScheduleHandler{
+		Db:             database,
+		HolidayCountry: cfg.Holidays.Country,
+		HolidayRegion:  cfg.Holidays.Region,
+		RequireIfMatch: cfg.Server.RequireIfMatch,
+	}
+	holidayEnv := &handlers.HolidayHandler{
+		Db: database,
+	}
+	changeRequestEnv := &handlers.ChangeRequestHandler{
+		Db: database,
+	}
+	apiKeyEnv := &handlers.ApiKeyHandler{
 		Db: database,
 	}
+	metricsEnv := &handlers.MetricsHandler{
+		Db: database,
+	}
+	broker := events.NewBroker()
+	eventEnv := &handlers.EventHandler{
+		Broker: broker,
+	}
+	publicationWorker := &workers.PublicationWorker{
+		Db:     database,
+		Broker: broker,
+	}
+	healthEnv := &handlers.HealthHandler{
+		Db:                database,
+		PublicationWorker: publicationWorker,
+	}
 	defer func() {
 		err := db.CloseDB()
 		if err != nil {
@@ -38,32 +135,152 @@ func main() {
 	}()
 
 	mux := http.NewServeMux()
-	routes.ProgramRouter(mux, programEnv)
-	routes.ScheduleRouter(mux, scheduleEnv)
+	router := routes.NewRouter(mux)
+	routes.ProgramRouter(router, programEnv)
+	routes.ScheduleRouter(router, scheduleEnv)
+	routes.HolidayRouter(router, holidayEnv)
+	routes.ChangeRequestRouter(router, changeRequestEnv)
+	routes.ApiKeyRouter(router, apiKeyEnv)
+	routes.EventRouter(router, eventEnv)
+	routes.MetricsRouter(router, metricsEnv)
+	routes.HealthRouter(router, healthEnv)
+	routes.ValidationRouter(router, &handlers.ValidationHandler{})
+	policies, err := router.Policies()
+	if err != nil {
+		log.Fatalf("Invalid route policies: %v", err)
+	}
 
-	wrappedMux := middlewares.AuthMiddleware(mux)
+	// JWTs issued by the partners identity provider are accepted only when its JWKS is configured
+	var jwtValidator *middlewares.JWTValidator
+	if jwt := cfg.Auth.JWT; jwt.JWKSFile != "" {
+		jwtValidator, err = middlewares.NewJWTValidator(jwt.JWKSFile, jwt.Issuer, jwt.Audience, jwt.RolesClaim)
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	}
+
+	limits, err := ratelimit.ParseLimits(cfg.RateLimits)
+	if err != nil {
+		log.Fatalf("Invalid rate limits: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(limits)
+	for path := range cfg.CacheControl {
+		if !middlewares.IsConditionalRoute(policies, path) {
+			log.Fatalf("Invalid cache control: %s is not a read route of programs, schedules, holidays or change requests", path)
+		}
+	}
+	conditionalMux := middlewares.ConditionalMiddleware(mux, mux, cfg.CacheControl, database)
+	clientLimitedMux := middlewares.ClientRateLimitMiddleware(conditionalMux, mux, limiter, cfg.Server.TrustProxyHeaders)
+	staticKeys := middlewares.StaticKeys{
+		Admin:   cfg.Auth.AdminAPIKey,
+		Manager: cfg.Auth.ManagerAPIKey,
+		Private: cfg.Auth.PrivateKey,
+		Public:  cfg.Auth.PublicAPIKey,
+	}
+	var authenticatedMux http.Handler = middlewares.AuthMiddleware(clientLimitedMux, mux, policies, database, jwtValidator, staticKeys)
+	if cfg.Server.TLS.ClientCAFile != "" {
+		authenticatedMux = middlewares.ClientCertMiddleware(authenticatedMux, mux)
+	}
+	rateLimitedMux := middlewares.RateLimitMiddleware(authenticatedMux, mux, limiter, cfg.Server.TrustProxyHeaders)
+	corsMux := middlewares.CORSMiddleware(rateLimitedMux, mux, middlewares.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	})
+	wrappedMux := middlewares.RequestIDMiddleware(middlewares.AccessLogMiddleware(middlewares.MetricsMiddleware(corsMux, mux)))
 
+	// Parent of every request context, cancelled when the shutdown times out so the queries still running are cancelled too
+	requestCtx, cancelRequests := context.WithCancelCause(context.Background())
+	defer cancelRequests(nil)
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: wrappedMux,
+		Addr:              cfg.Server.Addr,
+		Handler:           wrappedMux,
+		BaseContext:       func(net.Listener) context.Context { return requestCtx },
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go publicationWorker.Run(workerCtx)
+
+	// HTTPS is served natively when a certificate is configured, for the stations deployed without a reverse proxy
+	var redirectServer *http.Server
+	if tlsCfg := cfg.Server.TLS; tlsCfg.Enabled() {
+		reloader, err := tlsconfig.NewCertReloader(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		go reloader.Run(workerCtx, time.Duration(tlsCfg.ReloadInterval))
+		server.TLSConfig, err = tlsconfig.NewServerConfig(reloader, tlsCfg.ClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS client CAs: %v", err)
+		}
+
+		if tlsCfg.RedirectAddr != "" {
+			redirectHandler, err := tlsconfig.RedirectHandler(server.Addr)
+			if err != nil {
+				log.Fatalf("Invalid listen address: %v", err)
+			}
+			redirectServer = &http.Server{
+				Addr:              tlsCfg.RedirectAddr,
+				Handler:           redirectHandler,
+				ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+				IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+			}
+		}
 	}
+
 	// Start
 	go func() {
-		log.Println("Server listening on port 8080")
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Info("Server listening", "addr", server.Addr, "tls", server.TLSConfig != nil)
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("listen: %s\n", err)
 		}
 	}()
+	if redirectServer != nil {
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("listen: %s\n", err)
+			}
+		}()
+	}
 
 	interruptChan := make(chan os.Signal, 1)
 	signal.Notify(interruptChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	<-interruptChan
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
+	healthEnv.SetShuttingDown()
+	// Time left to the load balancers to see the failing readiness before the server stops accepting connections
+	time.Sleep(time.Duration(cfg.Server.ShutdownDrainDelay))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
 	defer cancel()
 
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+		slog.Warn("Shutdown timed out, cancelling the requests in flight", "error", err)
+		cancelRequests(problem.ErrServerShutdown)
+		graceCtx, cancelGrace := context.WithTimeout(context.Background(), time.Second)
+		defer cancelGrace()
+		if err = server.Shutdown(graceCtx); err != nil {
+			server.Close()
+		}
 	}
+	stopWorkers()
 }
@@ -0,0 +1,69 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// tokenPrefix Tokens look like ops_<prefix>_<secret>, the prefix identifies the key and is stored in clear
+const tokenPrefix = "ops_"
+
+// Generate Create a new random token, returning it along with its prefix and the hash of its secret
+func Generate() (token string, prefix string, hash []byte, err error) {
+	prefix, err = randomString(6, hex.EncodeToString)
+	if err != nil {
+		return "", "", nil, err
+	}
+	token, hash, err = GenerateSecret(prefix)
+	return token, prefix, hash, err
+}
+
+// GenerateSecret Create a new random token for an existing prefix, used to rotate a key
+func GenerateSecret(prefix string) (token string, hash []byte, err error) {
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenPrefix + prefix + "_" + secret, Hash(secret), nil
+}
+
+// Parse Split a token into its prefix and secret, ok is false if it is not an API key token
+func Parse(token string) (prefix string, secret string, ok bool) {
+	rest, found := strings.CutPrefix(token, tokenPrefix)
+	if !found {
+		return "", "", false
+	}
+	prefix, secret, found = strings.Cut(rest, "_")
+	if !found || prefix == "" || secret == "" {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+// Hash Secrets are random, so a plain SHA-256 is enough to store them safely
+func Hash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// Verify Compare a secret with a stored hash in constant time
+func Verify(secret string, hash []byte) bool {
+	return len(hash) > 0 && subtle.ConstantTimeCompare(Hash(secret), hash) == 1
+}
+
+// Equal Compare two static keys in constant time, an empty expected key never matches
+func Equal(clientKey string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(clientKey), []byte(expected)) == 1
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encode(buf), nil
+}
@@ -0,0 +1,77 @@
+package apperrors
+
+import "errors"
+
+// Kinds of the errors reported to clients, matched with errors.Is
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrValidation         = errors.New("validation failed")
+	ErrUnavailable        = errors.New("unavailable")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Error An error whose code and message are safe to report to clients. Its cause, if any, is only logged
+type Error struct {
+	Kind error
+	// Code Stable machine-readable identifier of the error, e.g. program_not_found
+	Code    string
+	Message string
+	// Fields Errors of the request fields, when the request is invalid
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError An invalid field of a request body
+type FieldError struct {
+	// Field JSON path of the field, e.g. substitutions[0].to_program_id
+	Field string `json:"field"`
+	// Code Stable machine-readable identifier of the error, e.g. too_long
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap Match both the kind and the cause of the error
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// NotFound The requested resource, or one it references, does not exist
+func NotFound(code string, message string) error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+// Conflict The request conflicts with the current state of the resource
+func Conflict(code string, message string) error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+// PreconditionFailed The resource changed since the client read it
+func PreconditionFailed(code string, message string) error {
+	return &Error{Kind: ErrPreconditionFailed, Code: code, Message: message}
+}
+
+// Validation The request is invalid
+func Validation(code string, message string) error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message}
+}
+
+// Invalid The request has invalid fields
+func Invalid(fields []FieldError) error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "The request has invalid fields", Fields: fields}
+}
+
+// Unavailable A dependency failed with an error that may go away on retry
+func Unavailable(code string, message string, cause error) error {
+	return &Error{Kind: ErrUnavailable, Code: code, Message: message, Err: cause}
+}
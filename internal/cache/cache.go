@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"container/list"
+	"openprogramschedule/internal/metrics"
+	"sync"
+	"time"
+)
+
+// Cache Values kept for a TTL, at most maxEntries of them, the least recently used being evicted first. It is safe for
+// concurrent use. A TTL or a size of 0 disables it. Hits, misses and evictions are counted by name in the metrics
+type Cache[V any] struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	// clone Copy a value, so callers cannot change the cached one
+	clone func(V) V
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order Entries from the most to the least recently used
+	order *list.List
+	// generation Incremented by Purge, so values loaded before it are not stored
+	generation uint64
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func New[V any](name string, ttl time.Duration, maxEntries int, clone func(V) V) *Cache[V] {
+	return &Cache[V]{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		clone:      clone,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Enabled Report whether the cache stores values
+func (c *Cache[V]) Enabled() bool {
+	return c.ttl > 0 && c.maxEntries > 0
+}
+
+// Load Get the value of key, calling load on a miss and storing its result unless it failed or the cache was purged
+// meanwhile, as the value may predate the write that purged it
+func (c *Cache[V]) Load(key string, load func() (V, error)) (V, error) {
+	if !c.Enabled() {
+		return load()
+	}
+
+	c.mu.Lock()
+	if element, found := c.entries[key]; found {
+		cached := element.Value.(*entry[V])
+		if time.Now().Before(cached.expires) {
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			metrics.CacheHits.Inc(c.name)
+			return c.clone(cached.value), nil
+		}
+		c.remove(element)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	metrics.CacheMisses.Inc(c.name)
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return value, nil
+	}
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: c.clone(value), expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		metrics.CacheEvictions.Inc(c.name)
+	}
+	return value, nil
+}
+
+// Purge Remove every value, e.g. after a write changed the data they were loaded from
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Name Get the name the cache is counted by
+func (c *Cache[V]) Name() string {
+	return c.name
+}
+
+// Len Get the number of values, expired ones not yet evicted included
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache[V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[V]).key)
+}
@@ -0,0 +1,436 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"openprogramschedule/internal/logging"
+	"openprogramschedule/internal/ratelimit"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Duration A time.Duration written as "30s" in the config file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("expected a duration such as \"30s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type ServerConfig struct {
+	Addr               string   `json:"addr"`
+	ReadHeaderTimeout  Duration `json:"read_header_timeout"`
+	ReadTimeout        Duration `json:"read_timeout"`
+	WriteTimeout       Duration `json:"write_timeout"`
+	IdleTimeout        Duration `json:"idle_timeout"`
+	ShutdownTimeout    Duration `json:"shutdown_timeout"`
+	ShutdownDrainDelay Duration `json:"shutdown_drain_delay"`
+	TrustProxyHeaders  bool     `json:"trust_proxy_headers"`
+	// RequireIfMatch Reject the updates and deletes of programs and schedules without If-Match with 428
+	RequireIfMatch bool      `json:"require_if_match"`
+	TLS            TLSConfig `json:"tls"`
+}
+
+// TLSConfig HTTPS is served when the certificate and key are set, the client CA enables mutual TLS on the write endpoints
+type TLSConfig struct {
+	CertFile       string   `json:"cert_file"`
+	KeyFile        string   `json:"key_file"`
+	ClientCAFile   string   `json:"client_ca_file"`
+	RedirectAddr   string   `json:"redirect_addr"`
+	ReloadInterval Duration `json:"reload_interval"`
+}
+
+// Enabled Report whether HTTPS is served
+func (config TLSConfig) Enabled() bool {
+	return config.CertFile != ""
+}
+
+// DatabaseConfig The DSN, when set, takes precedence over the separate connection settings
+type DatabaseConfig struct {
+	DSN             string   `json:"dsn"`
+	User            string   `json:"user"`
+	Password        string   `json:"password"`
+	Host            string   `json:"host"`
+	Port            string   `json:"port"`
+	Name            string   `json:"name"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+	ReadTimeout     Duration `json:"read_timeout"`
+	WriteTimeout    Duration `json:"write_timeout"`
+	// QueryTimeouts Timeout of single repository functions, overriding the read or write one
+	QueryTimeouts map[string]Duration `json:"query_timeouts"`
+	// ConnectTimeout How long the server waits at startup for the database to answer
+	ConnectTimeout   Duration `json:"connect_timeout"`
+	RetryMaxAttempts int      `json:"retry_max_attempts"`
+	RetryBaseDelay   Duration `json:"retry_base_delay"`
+	RetryMaxDelay    Duration `json:"retry_max_delay"`
+	// BreakerThreshold Consecutive failures opening the circuit breaker, 0 disables it
+	BreakerThreshold int      `json:"breaker_threshold"`
+	BreakerCooldown  Duration `json:"breaker_cooldown"`
+	// CacheTTL How long the public program and schedule reads are cached, 0 disables the cache
+	CacheTTL Duration `json:"cache_ttl"`
+	// CacheMaxEntries Reads kept by the program cache and by the schedule cache each
+	CacheMaxEntries int `json:"cache_max_entries"`
+}
+
+type JWTConfig struct {
+	JWKSFile   string `json:"jwks_file"`
+	Issuer     string `json:"issuer"`
+	Audience   string `json:"audience"`
+	RolesClaim string `json:"roles_claim"`
+}
+
+// AuthConfig Static keys of each role, empty keys are disabled
+type AuthConfig struct {
+	AdminAPIKey   string    `json:"admin_api_key"`
+	ManagerAPIKey string    `json:"manager_api_key"`
+	PrivateKey    string    `json:"private_key"`
+	PublicAPIKey  string    `json:"public_api_key"`
+	JWT           JWTConfig `json:"jwt"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"`
+}
+
+type LoggingConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+type HolidayConfig struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+}
+
+// ValidationConfig Rules merged over the default rule of the same model field, in the validators.Rule format, and the
+// custom checks to enable. They are checked by validators.NewRuleSet
+type ValidationConfig struct {
+	Rules  map[string]map[string]json.RawMessage `json:"rules"`
+	Checks []string                              `json:"checks"`
+}
+
+// Config Settings of the server, loaded from the defaults, the config file, the environment and the flags, in increasing precedence
+type Config struct {
+	Server     ServerConfig     `json:"server"`
+	Database   DatabaseConfig   `json:"database"`
+	Auth       AuthConfig       `json:"auth"`
+	CORS       CORSConfig       `json:"cors"`
+	Logging    LoggingConfig    `json:"logging"`
+	Holidays   HolidayConfig    `json:"holidays"`
+	Validation ValidationConfig `json:"validation"`
+	// RateLimits Limit of each route group, in the ratelimit.ParseLimit format
+	RateLimits map[string]string `json:"rate_limits"`
+	// CacheControl Cache-Control of the public responses of each read route, keyed by its path, e.g. /schedules/all
+	CacheControl map[string]string `json:"cache_control"`
+}
+
+// Default Settings used when neither the config file, the environment nor the flags set them
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:               ":8080",
+			ReadHeaderTimeout:  Duration(10 * time.Second),
+			ReadTimeout:        Duration(30 * time.Second),
+			WriteTimeout:       Duration(60 * time.Second),
+			IdleTimeout:        Duration(120 * time.Second),
+			ShutdownTimeout:    Duration(5 * time.Second),
+			ShutdownDrainDelay: Duration(5 * time.Second),
+			TLS: TLSConfig{
+				ReloadInterval: Duration(time.Minute),
+			},
+		},
+		Database: DatabaseConfig{
+			Port:             "1433",
+			MaxOpenConns:     25,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  Duration(30 * time.Minute),
+			ConnMaxIdleTime:  Duration(5 * time.Minute),
+			ReadTimeout:      Duration(5 * time.Second),
+			WriteTimeout:     Duration(10 * time.Second),
+			ConnectTimeout:   Duration(2 * time.Minute),
+			RetryMaxAttempts: 3,
+			RetryBaseDelay:   Duration(100 * time.Millisecond),
+			RetryMaxDelay:    Duration(2 * time.Second),
+			BreakerThreshold: 5,
+			BreakerCooldown:  Duration(30 * time.Second),
+			CacheTTL:         Duration(30 * time.Second),
+			CacheMaxEntries:  1000,
+		},
+		Auth: AuthConfig{
+			JWT: JWTConfig{RolesClaim: "roles"},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Modified-Since"},
+			ExposedHeaders: []string{"ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			MaxAge:         3600,
+		},
+		Logging: LoggingConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		RateLimits: map[string]string{
+			ratelimit.DefaultGroup: "ip=10/20",
+		},
+	}
+}
+
+// Load Build the configuration from the config file named by -config or CONFIG_FILE, the environment and the flags in args.
+// It returns flag.ErrHelp, after printing the usage, when args ask for help
+func Load(args []string) (Config, error) {
+	config := Default()
+	settings := config.settings()
+
+	flags := flag.NewFlagSet("openprogramschedule", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path of the JSON config file")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.flag] = flags.String(s.flag, "", s.help)
+	}
+	rateLimits := &rateLimitFlag{}
+	flags.Var(rateLimits, "rate-limit", "limit of a route group, as group=limit, repeatable")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if *configFile != "" {
+		if err := config.loadFile(*configFile); err != nil {
+			return Config{}, err
+		}
+	}
+	if config.RateLimits == nil {
+		config.RateLimits = make(map[string]string)
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if value, found := os.LookupEnv(s.env); found && value != "" {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", s.env, err))
+			}
+		}
+	}
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if group, found := strings.CutPrefix(name, "RATE_LIMIT_"); found {
+			config.RateLimits[strings.ReplaceAll(strings.ToLower(group), "_", "-")] = value
+		}
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	for _, s := range settings {
+		if setFlags[s.flag] {
+			if err := s.set(*values[s.flag]); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %v", s.flag, err))
+			}
+		}
+	}
+	for group, limit := range rateLimits.limits {
+		config.RateLimits[group] = limit
+	}
+
+	if err := errors.Join(append(errs, config.Validate())...); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// loadFile Override the settings with the ones of a JSON config file, unknown keys are errors so typos are not ignored
+func (config *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate Check every setting, reporting all the invalid ones at once
+func (config *Config) Validate() error {
+	var errs []error
+	check := func(failed bool, format string, args ...any) {
+		if failed {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.Server.Addr == "", "server.addr must not be empty")
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_header_timeout", config.Server.ReadHeaderTimeout},
+		{"server.read_timeout", config.Server.ReadTimeout},
+		{"server.write_timeout", config.Server.WriteTimeout},
+		{"server.idle_timeout", config.Server.IdleTimeout},
+		{"server.shutdown_timeout", config.Server.ShutdownTimeout},
+		{"server.shutdown_drain_delay", config.Server.ShutdownDrainDelay},
+		{"server.tls.reload_interval", config.Server.TLS.ReloadInterval},
+		{"database.conn_max_lifetime", config.Database.ConnMaxLifetime},
+		{"database.conn_max_idle_time", config.Database.ConnMaxIdleTime},
+		{"database.read_timeout", config.Database.ReadTimeout},
+		{"database.write_timeout", config.Database.WriteTimeout},
+		{"database.retry_base_delay", config.Database.RetryBaseDelay},
+		{"database.retry_max_delay", config.Database.RetryMaxDelay},
+		{"database.breaker_cooldown", config.Database.BreakerCooldown},
+	} {
+		check(timeout.value < 0, "%s must not be negative", timeout.name)
+	}
+
+	tlsConfig := config.Server.TLS
+	check((tlsConfig.CertFile == "") != (tlsConfig.KeyFile == ""), "server.tls.cert_file and server.tls.key_file must be set together")
+	check(!tlsConfig.Enabled() && tlsConfig.ClientCAFile != "", "server.tls.client_ca_file requires server.tls.cert_file")
+	check(!tlsConfig.Enabled() && tlsConfig.RedirectAddr != "", "server.tls.redirect_addr requires server.tls.cert_file")
+	check(tlsConfig.Enabled() && tlsConfig.ReloadInterval == 0, "server.tls.reload_interval must be positive")
+	for _, file := range []struct {
+		name string
+		path string
+	}{
+		{"server.tls.cert_file", tlsConfig.CertFile},
+		{"server.tls.key_file", tlsConfig.KeyFile},
+		{"server.tls.client_ca_file", tlsConfig.ClientCAFile},
+	} {
+		if file.path != "" {
+			_, err := os.Stat(file.path)
+			check(err != nil, "%s: %v", file.name, err)
+		}
+	}
+
+	check(config.Database.DSN == "" && (config.Database.Host == "" || config.Database.Name == ""),
+		"database.dsn or both database.host and database.name must be set")
+	check(config.Database.MaxOpenConns < 0, "database.max_open_conns must not be negative")
+	check(config.Database.MaxIdleConns < 0, "database.max_idle_conns must not be negative")
+	check(config.Database.MaxOpenConns > 0 && config.Database.MaxIdleConns > config.Database.MaxOpenConns,
+		"database.max_idle_conns must not exceed database.max_open_conns")
+	check(config.Database.ConnectTimeout <= 0, "database.connect_timeout must be positive")
+	check(config.Database.RetryMaxAttempts < 1, "database.retry_max_attempts must be at least 1")
+	check(config.Database.BreakerThreshold < 0, "database.breaker_threshold must not be negative")
+	check(config.Database.CacheTTL < 0, "database.cache_ttl must not be negative")
+	check(config.Database.CacheMaxEntries < 0, "database.cache_max_entries must not be negative")
+	functions := make([]string, 0, len(config.Database.QueryTimeouts))
+	for function := range config.Database.QueryTimeouts {
+		functions = append(functions, function)
+	}
+	sort.Strings(functions)
+	for _, function := range functions {
+		check(config.Database.QueryTimeouts[function] < 0, "database.query_timeouts.%s must not be negative", function)
+	}
+
+	if config.Auth.JWT.JWKSFile != "" {
+		_, err := os.Stat(config.Auth.JWT.JWKSFile)
+		check(err != nil, "auth.jwt.jwks_file: %v", err)
+		check(config.Auth.JWT.Issuer == "", "auth.jwt.issuer is required with auth.jwt.jwks_file")
+		check(config.Auth.JWT.Audience == "", "auth.jwt.audience is required with auth.jwt.jwks_file")
+	}
+
+	check(len(config.CORS.AllowedOrigins) == 0, "cors.allowed_origins must not be empty")
+	check(config.CORS.AllowCredentials && slices.Contains(config.CORS.AllowedOrigins, "*"),
+		"cors.allowed_origins must list the origins by name when cors.allow_credentials is set, not *")
+	check(config.CORS.MaxAge < 0, "cors.max_age must not be negative")
+
+	_, err := logging.ParseLevel(config.Logging.Level)
+	check(err != nil, "logging.level: %v", err)
+	check(config.Logging.Format != "json" && config.Logging.Format != "text",
+		"logging.format must be json or text, got %q", config.Logging.Format)
+
+	groups := make([]string, 0, len(config.RateLimits))
+	for group := range config.RateLimits {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		_, err := ratelimit.ParseLimit(config.RateLimits[group])
+		check(err != nil, "rate_limits.%s: %v", group, err)
+	}
+
+	paths := make([]string, 0, len(config.CacheControl))
+	for path := range config.CacheControl {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		check(!strings.HasPrefix(path, "/"), "cache_control: route path %q must start with /", path)
+		check(strings.TrimSpace(config.CacheControl[path]) == "", "cache_control.%s must not be empty", path)
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted Get a copy of the configuration with its secrets hidden, to be printed or logged
+func (config Config) Redacted() Config {
+	redact := func(value *string) {
+		if *value != "" {
+			*value = "REDACTED"
+		}
+	}
+	redact(&config.Database.DSN)
+	redact(&config.Database.Password)
+	redact(&config.Auth.AdminAPIKey)
+	redact(&config.Auth.ManagerAPIKey)
+	redact(&config.Auth.PrivateKey)
+	redact(&config.Auth.PublicAPIKey)
+	return config
+}
+
+// Print Write the effective configuration as JSON, secrets redacted
+func (config Config) Print(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(config.Redacted())
+}
+
+// rateLimitFlag Collect the repeated -rate-limit group=limit flags
+type rateLimitFlag struct {
+	limits map[string]string
+}
+
+func (f *rateLimitFlag) String() string {
+	return ""
+}
+
+func (f *rateLimitFlag) Set(value string) error {
+	group, limit, found := strings.Cut(value, "=")
+	if !found || group == "" {
+		return fmt.Errorf("expected group=limit, got %q", value)
+	}
+	if f.limits == nil {
+		f.limits = make(map[string]string)
+	}
+	f.limits[group] = limit
+	return nil
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting A configuration value settable through an environment variable and a flag
+type setting struct {
+	flag string
+	env  string
+	help string
+	set  func(value string) error
+}
+
+func stringSetting(flag string, env string, help string, target *string) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		*target = value
+		return nil
+	}}
+}
+
+func intSetting(flag string, env string, help string, target *int) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}}
+}
+
+func boolSetting(flag string, env string, help string, target *bool) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}}
+}
+
+func durationSetting(flag string, env string, help string, target *Duration) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = Duration(parsed)
+		return nil
+	}}
+}
+
+// listSetting A comma separated list
+func listSetting(flag string, env string, help string, target *[]string) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*target = items
+		return nil
+	}}
+}
+
+// durationMapSetting A comma separated list of name=duration pairs, replacing the whole map
+func durationMapSetting(flag string, env string, help string, target *map[string]Duration) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		durations := make(map[string]Duration)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			name, duration, found := strings.Cut(item, "=")
+			if !found || name == "" {
+				return fmt.Errorf("expected name=duration, got %q", item)
+			}
+			parsed, err := time.ParseDuration(duration)
+			if err != nil {
+				return err
+			}
+			durations[name] = Duration(parsed)
+		}
+		*target = durations
+		return nil
+	}}
+}
+
+// headerMapSetting A semicolon separated list of path=value pairs, replacing the whole map. Header values may hold commas
+func headerMapSetting(flag string, env string, help string, target *map[string]string) setting {
+	return setting{flag: flag, env: env, help: help, set: func(value string) error {
+		values := make(map[string]string)
+		for _, item := range strings.Split(value, ";") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			path, headerValue, found := strings.Cut(item, "=")
+			if !found || path == "" {
+				return fmt.Errorf("expected path=value, got %q", item)
+			}
+			values[strings.TrimSpace(path)] = strings.TrimSpace(headerValue)
+		}
+		*target = values
+		return nil
+	}}
+}
+
+// settings Every setting of the configuration, the environment variables predating the config file keep their names
+func (config *Config) settings() []setting {
+	return []setting{
+		stringSetting("addr", "LISTEN_ADDR", "address the server listens on", &config.Server.Addr),
+		durationSetting("read-header-timeout", "SERVER_READ_HEADER_TIMEOUT", "time allowed to read the request headers", &config.Server.ReadHeaderTimeout),
+		durationSetting("read-timeout", "SERVER_READ_TIMEOUT", "time allowed to read a whole request", &config.Server.ReadTimeout),
+		durationSetting("write-timeout", "SERVER_WRITE_TIMEOUT", "time allowed to write a response, except event streams", &config.Server.WriteTimeout),
+		durationSetting("idle-timeout", "SERVER_IDLE_TIMEOUT", "time an idle keep-alive connection is kept", &config.Server.IdleTimeout),
+		durationSetting("shutdown-timeout", "SHUTDOWN_TIMEOUT", "time allowed to in-flight requests on shutdown", &config.Server.ShutdownTimeout),
+		durationSetting("shutdown-drain-delay", "SHUTDOWN_DRAIN_DELAY", "time /readyz fails before the server stops accepting connections", &config.Server.ShutdownDrainDelay),
+		stringSetting("tls-cert-file", "TLS_CERT_FILE", "PEM certificate enabling HTTPS", &config.Server.TLS.CertFile),
+		stringSetting("tls-key-file", "TLS_KEY_FILE", "PEM private key of the certificate", &config.Server.TLS.KeyFile),
+		stringSetting("tls-client-ca-file", "TLS_CLIENT_CA_FILE", "PEM CAs enabling mutual TLS on the write endpoints", &config.Server.TLS.ClientCAFile),
+		stringSetting("tls-redirect-addr", "TLS_REDIRECT_ADDR", "address of a plain HTTP listener redirecting to HTTPS", &config.Server.TLS.RedirectAddr),
+		durationSetting("tls-reload-interval", "TLS_RELOAD_INTERVAL", "how often the certificate files are checked for changes", &config.Server.TLS.ReloadInterval),
+		boolSetting("trust-proxy-headers", "TRUST_PROXY_HEADERS", "identify clients by X-Forwarded-For", &config.Server.TrustProxyHeaders),
+		boolSetting("require-if-match", "REQUIRE_IF_MATCH", "reject updates and deletes of programs and schedules without If-Match", &config.Server.RequireIfMatch),
+
+		stringSetting("db-dsn", "DB_DSN", "SQL Server connection string, overrides the other database settings", &config.Database.DSN),
+		stringSetting("db-user", "DB_USER", "database user", &config.Database.User),
+		stringSetting("db-password", "DB_PASSWORD", "database password", &config.Database.Password),
+		stringSetting("db-host", "DB_HOST", "database host", &config.Database.Host),
+		stringSetting("db-port", "DB_PORT", "database port", &config.Database.Port),
+		stringSetting("db-name", "DB_NAME", "database name", &config.Database.Name),
+		intSetting("db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum open connections, 0 for unlimited", &config.Database.MaxOpenConns),
+		intSetting("db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum idle connections", &config.Database.MaxIdleConns),
+		durationSetting("db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "maximum lifetime of a connection, 0 for unlimited", &config.Database.ConnMaxLifetime),
+		durationSetting("db-conn-max-idle-time", "DB_CONN_MAX_IDLE_TIME", "maximum idle time of a connection, 0 for unlimited", &config.Database.ConnMaxIdleTime),
+		durationSetting("db-read-timeout", "DB_READ_TIMEOUT", "timeout of the read queries, 0 for none", &config.Database.ReadTimeout),
+		durationSetting("db-write-timeout", "DB_WRITE_TIMEOUT", "timeout of the write queries, 0 for none", &config.Database.WriteTimeout),
+		durationSetting("db-connect-timeout", "DB_CONNECT_TIMEOUT", "how long to wait at startup for the database", &config.Database.ConnectTimeout),
+		intSetting("db-retry-max-attempts", "DB_RETRY_MAX_ATTEMPTS", "attempts of a query failing with transient errors, 1 disables retries", &config.Database.RetryMaxAttempts),
+		durationSetting("db-retry-base-delay", "DB_RETRY_BASE_DELAY", "delay before the first retry, doubled at each retry", &config.Database.RetryBaseDelay),
+		durationSetting("db-retry-max-delay", "DB_RETRY_MAX_DELAY", "maximum delay between retries", &config.Database.RetryMaxDelay),
+		intSetting("db-breaker-threshold", "DB_BREAKER_THRESHOLD", "consecutive failures opening the circuit breaker, 0 disables it", &config.Database.BreakerThreshold),
+		durationSetting("db-breaker-cooldown", "DB_BREAKER_COOLDOWN", "how long the circuit breaker fails fast before probing the database", &config.Database.BreakerCooldown),
+		durationSetting("db-cache-ttl", "DB_CACHE_TTL", "how long the public program and schedule reads are cached, 0 disables the cache", &config.Database.CacheTTL),
+		intSetting("db-cache-max-entries", "DB_CACHE_MAX_ENTRIES", "reads kept by the program cache and by the schedule cache each", &config.Database.CacheMaxEntries),
+		durationMapSetting("db-query-timeouts", "DB_QUERY_TIMEOUTS", "comma separated function=timeout overrides, e.g. GetAllSchedules=15s", &config.Database.QueryTimeouts),
+
+		stringSetting("admin-api-key", "ADMIN_API_KEY", "static key of the admins", &config.Auth.AdminAPIKey),
+		stringSetting("manager-api-key", "MANAGER_API_KEY", "static key of the managers", &config.Auth.ManagerAPIKey),
+		stringSetting("private-key", "PRIVATE_KEY", "static key of the editors", &config.Auth.PrivateKey),
+		stringSetting("public-api-key", "PUBLIC_API_KEY", "static key of the public clients", &config.Auth.PublicAPIKey),
+		stringSetting("jwt-jwks-file", "JWT_JWKS_FILE", "JWKS file enabling JWT authentication", &config.Auth.JWT.JWKSFile),
+		stringSetting("jwt-issuer", "JWT_ISSUER", "expected iss claim", &config.Auth.JWT.Issuer),
+		stringSetting("jwt-audience", "JWT_AUDIENCE", "expected aud claim", &config.Auth.JWT.Audience),
+		stringSetting("jwt-roles-claim", "JWT_ROLES_CLAIM", "claim holding the roles", &config.Auth.JWT.RolesClaim),
+
+		listSetting("cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins, * for any", &config.CORS.AllowedOrigins),
+		listSetting("cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma separated methods", &config.CORS.AllowedMethods),
+		listSetting("cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma separated request headers", &config.CORS.AllowedHeaders),
+		listSetting("cors-exposed-headers", "CORS_EXPOSED_HEADERS", "comma separated response headers", &config.CORS.ExposedHeaders),
+		boolSetting("cors-allow-credentials", "CORS_ALLOW_CREDENTIALS", "allow credentialed requests", &config.CORS.AllowCredentials),
+		intSetting("cors-max-age", "CORS_MAX_AGE", "seconds browsers may cache a preflight", &config.CORS.MaxAge),
+
+		stringSetting("log-format", "LOG_FORMAT", "text or json", &config.Logging.Format),
+		stringSetting("log-level", "LOG_LEVEL", "debug, info, warn or error", &config.Logging.Level),
+
+		stringSetting("holiday-country", "HOLIDAY_COUNTRY", "default country of the holiday calendar", &config.Holidays.Country),
+		stringSetting("holiday-region", "HOLIDAY_REGION", "default region of the holiday calendar", &config.Holidays.Region),
+
+		headerMapSetting("cache-control", "CACHE_CONTROL", "semicolon separated path=Cache-Control pairs of the public read routes, e.g. /schedules/all=public, max-age=60", &config.CacheControl),
+
+		listSetting("validation-checks", "VALIDATION_CHECKS", "comma separated custom validation checks to enable", &config.Validation.Checks),
+	}
+}
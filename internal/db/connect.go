@@ -1,45 +1,44 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/microsoft/go-mssqldb"
 	"log"
-	"os"
+	"log/slog"
+	"openprogramschedule/internal/config"
+	"openprogramschedule/internal/resilience"
+	"time"
 )
 
 var db *sql.DB
 
-type EnvDBConfig struct {
-	user     string
-	password string
-	server   string
-	name     string
-	port     string
-}
+// SchemaVersion Version of the schema created by ConnectDB, bump it with every migration
+const SchemaVersion = 4
 
-func NewEnvDBConfig() *EnvDBConfig {
-	return &EnvDBConfig{
-		user:     os.Getenv("DB_USER"),     // Es. "myuser"
-		password: os.Getenv("DB_PASSWORD"), // Es. "mypassword"
-		server:   os.Getenv("DB_HOST"),     // Es. "myserver.mysql.database.azure.com"
-		name:     os.Getenv("DB_NAME"),     // Es. "mydatabase"
-		port:     os.Getenv("DB_PORT"),     // Es. "3306"
+// dataSourceName Get the connection string of the database, the DSN if configured
+func dataSourceName(config config.DatabaseConfig) string {
+	if config.DSN != "" {
+		return config.DSN
 	}
+	return fmt.Sprintf("server=%s;user id=%s;password=%s;port=%s;database=%s;",
+		config.Host, config.User, config.Password, config.Port, config.Name)
 }
 
 // ConnectDB Remember to allow your ip on SQL Server, or it doesn't work
-func ConnectDB() *sql.DB {
-	config := NewEnvDBConfig()
-
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%s;database=%s;",
-		config.server, config.user, config.password, config.port, config.name)
+func ConnectDB(config config.DatabaseConfig) *sql.DB {
+	connString := dataSourceName(config)
 	var err error
 	db, err = sql.Open("sqlserver", connString)
 	if err != nil {
 		log.Fatalf("Failed to open a DB connection: %v", err)
 	}
-	if err := db.Ping(); err != nil {
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(config.ConnMaxIdleTime))
+	if err := waitForDB(time.Duration(config.ConnectTimeout)); err != nil {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
@@ -74,10 +73,249 @@ END
 	if err != nil {
 		log.Fatalf("Error while creating table schedules: %v", err)
 	}
-	log.Println("Successfully connected to DB")
+
+	_, err = db.Exec(`
+IF COL_LENGTH('schedules', 'is_override') IS NULL
+BEGIN
+    ALTER TABLE schedules ADD
+        end_date DATETIME NULL,
+        is_override BIT NOT NULL DEFAULT 0,
+        override_reason NVARCHAR(255) NULL
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while adding override columns to schedules: %v", err)
+	}
+
+	// Schedules created before the lifecycle states were already visible, so they start as published
+	_, err = db.Exec(`
+IF COL_LENGTH('schedules', 'status') IS NULL
+BEGIN
+    ALTER TABLE schedules ADD status NVARCHAR(20) NOT NULL DEFAULT 'published' WITH VALUES
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while adding status column to schedules: %v", err)
+	}
+
+	_, err = db.Exec(`
+IF COL_LENGTH('programs', 'publish_at') IS NULL
+BEGIN
+    ALTER TABLE programs ADD
+        publish_at DATETIME NULL,
+        embargoed BIT NOT NULL DEFAULT 0
+END
+IF COL_LENGTH('schedules', 'publish_at') IS NULL
+BEGIN
+    ALTER TABLE schedules ADD
+        publish_at DATETIME NULL,
+        embargoed BIT NOT NULL DEFAULT 0
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while adding embargo columns: %v", err)
+	}
+
+	// Row versions change with every write to a row, so editors can tell whether it changed since they read it
+	_, err = db.Exec(`
+IF COL_LENGTH('programs', 'row_version') IS NULL
+BEGIN
+    ALTER TABLE programs ADD row_version ROWVERSION
+END
+IF COL_LENGTH('schedules', 'row_version') IS NULL
+BEGIN
+    ALTER TABLE schedules ADD row_version ROWVERSION
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while adding row version columns: %v", err)
+	}
+
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'change_requests')
+BEGIN
+    CREATE TABLE change_requests (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        action NVARCHAR(10) NOT NULL,
+        schedule_id INT NULL,
+        payload NVARCHAR(MAX) NULL,
+        comment NVARCHAR(500) NOT NULL,
+        status NVARCHAR(20) NOT NULL DEFAULT 'pending',
+        submitted_by NVARCHAR(100) NOT NULL,
+        submitted_at DATETIME NOT NULL DEFAULT GETUTCDATE(),
+        reviewed_by NVARCHAR(100) NULL,
+        reviewed_at DATETIME NULL,
+        review_comment NVARCHAR(500) NULL
+    )
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while creating table change_requests: %v", err)
+	}
+
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'api_keys')
+BEGIN
+    CREATE TABLE api_keys (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        name NVARCHAR(100) NOT NULL UNIQUE,
+        prefix NVARCHAR(16) NOT NULL UNIQUE,
+        secret_hash VARBINARY(32) NOT NULL,
+        previous_secret_hash VARBINARY(32) NULL,
+        previous_expires_at DATETIME NULL,
+        scopes NVARCHAR(500) NOT NULL,
+        created_at DATETIME NOT NULL DEFAULT GETUTCDATE(),
+        expires_at DATETIME NULL,
+        revoked_at DATETIME NULL,
+        rotated_at DATETIME NULL
+    )
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while creating table api_keys: %v", err)
+	}
+
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'holidays')
+BEGIN
+    CREATE TABLE holidays (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        name NVARCHAR(100) NOT NULL,
+        date DATE NOT NULL,
+        country NVARCHAR(2) NOT NULL,
+        region NVARCHAR(100) NULL,
+        recurring BIT NOT NULL DEFAULT 0,
+        lineup_day INT NULL
+    )
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while creating table holidays: %v", err)
+	}
+
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'holiday_substitutions')
+BEGIN
+    CREATE TABLE holiday_substitutions (
+        id INT IDENTITY(1,1) PRIMARY KEY,
+        holiday_id INT NOT NULL,
+        from_program_id INT NOT NULL,
+        to_program_id INT NOT NULL,
+        FOREIGN KEY (holiday_id) REFERENCES holidays(id) ON DELETE CASCADE,
+        FOREIGN KEY (from_program_id) REFERENCES programs(id),
+        FOREIGN KEY (to_program_id) REFERENCES programs(id)
+    )
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while creating table holiday_substitutions: %v", err)
+	}
+
+	// Row versions of the other tables served to clients, so conditional requests can tell whether they changed
+	_, err = db.Exec(`
+IF COL_LENGTH('holidays', 'row_version') IS NULL
+BEGIN
+    ALTER TABLE holidays ADD row_version ROWVERSION
+END
+IF COL_LENGTH('holiday_substitutions', 'row_version') IS NULL
+BEGIN
+    ALTER TABLE holiday_substitutions ADD row_version ROWVERSION
+END
+IF COL_LENGTH('change_requests', 'row_version') IS NULL
+BEGIN
+    ALTER TABLE change_requests ADD row_version ROWVERSION
+END
+`)
+	if err != nil {
+		log.Fatalf("Error while adding row version columns: %v", err)
+	}
+
+	// Data version of each table served to clients, bumped by its triggers along with every write, so conditional
+	// requests check a few rows instead of the tables. modified is shared by the instances and grows by at least a
+	// second with every write, so If-Modified-Since never matches a later version
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'data_versions')
+BEGIN
+    CREATE TABLE data_versions (
+        table_name NVARCHAR(128) NOT NULL PRIMARY KEY,
+        version ROWVERSION,
+        modified DATETIME2(0) NOT NULL
+    )
+END
+INSERT INTO data_versions (table_name, modified)
+SELECT t.name, DATEADD(second, DATEDIFF(second, '2000-01-01', SYSUTCDATETIME()), CAST('2000-01-01' AS DATETIME2(0)))
+FROM (VALUES ('programs'), ('schedules'), ('holidays'), ('holiday_substitutions'), ('change_requests')) t(name)
+WHERE NOT EXISTS (SELECT 1 FROM data_versions WHERE table_name = t.name)
+`)
+	if err != nil {
+		log.Fatalf("Error while creating table data_versions: %v", err)
+	}
+	for _, table := range []string{"programs", "schedules", "holidays", "holiday_substitutions", "change_requests"} {
+		_, err = db.Exec(`
+CREATE OR ALTER TRIGGER ` + table + `_data_version ON ` + table + ` AFTER INSERT, UPDATE, DELETE AS
+BEGIN
+    SET NOCOUNT ON;
+    IF NOT EXISTS (SELECT 1 FROM inserted) AND NOT EXISTS (SELECT 1 FROM deleted) RETURN;
+    DECLARE @modified DATETIME2(0) = DATEADD(second, DATEDIFF(second, '2000-01-01', SYSUTCDATETIME()), CAST('2000-01-01' AS DATETIME2(0)));
+    DECLARE @latest DATETIME2(0) = (SELECT MAX(modified) FROM data_versions WITH (UPDLOCK, HOLDLOCK));
+    IF @latest >= @modified SET @modified = DATEADD(second, 1, @latest);
+    UPDATE data_versions SET modified = @modified WHERE table_name = '` + table + `';
+END
+`)
+		if err != nil {
+			log.Fatalf("Error while creating the data version trigger of %s: %v", table, err)
+		}
+	}
+	_, err = db.Exec(`
+IF NOT EXISTS (SELECT * FROM sys.tables WHERE name = 'schema_version')
+BEGIN
+    CREATE TABLE schema_version (
+        version INT NOT NULL
+    )
+END
+IF EXISTS (SELECT * FROM schema_version)
+    UPDATE schema_version SET version = @version WHERE version < @version
+ELSE
+    INSERT INTO schema_version (version) VALUES (@version)
+`, sql.Named("version", SchemaVersion))
+	if err != nil {
+		log.Fatalf("Error while recording the schema version: %v", err)
+	}
+	slog.Info("Successfully connected to DB")
 	return db
 }
 
+// connectBackoff Delays between the connection attempts at startup, e.g. while Azure SQL resumes or fails over
+var connectBackoff = resilience.Backoff{BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+// waitForDB Ping the database until it answers, backing off between the attempts that fail with a transient error,
+// for up to timeout. Permanent errors, such as invalid credentials, are returned right away
+func waitForDB(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if resilience.Classify(err) == resilience.Permanent && ctx.Err() == nil {
+			return err
+		}
+		delay := connectBackoff.Delay(attempt)
+		slog.Warn("Database not reachable yet", "attempt", attempt+1, "retry_in", delay.String(), "error", err)
+		if resilience.Wait(ctx, delay) != nil {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt+1, err)
+		}
+	}
+}
+
 func CloseDB() error {
 	return db.Close()
 }
+
+// GetSchemaVersion Get the version of the schema recorded in the database
+func GetSchemaVersion(ctx context.Context, database *sql.DB) (int, error) {
+	var version int
+	err := database.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version;`).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types, released programs and schedules are out of embargo
+const (
+	ProgramReleased  = "program.released"
+	ScheduleReleased = "schedule.released"
+)
+
+type Event struct {
+	Type string    `json:"type"`
+	Id   uint      `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// Broker Fan out events to every subscriber
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe Register a new subscriber, remember to Unsubscribe it
+func (b *Broker) Subscribe() chan Event {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Publish Send an event to every subscriber. Events are dropped for subscribers too slow to keep up
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
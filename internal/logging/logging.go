@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID Attach a request ID to the context, it is added to every record logged with it
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID Get the request ID attached to the context, empty outside a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// contextHandler Add the request ID found in the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ParseLevel Parse one of debug, info, warn or error, info when empty
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", level)
+	}
+	return parsed, nil
+}
+
+// NewLogger Create a logger writing in the json or text format, text when empty
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	parsedLevel, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: parsedLevel}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected json or text", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Setup Make a new logger the default one, the log package included
+func Setup(w io.Writer, format string, level string) error {
+	logger, err := NewLogger(w, format, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return nil
+}
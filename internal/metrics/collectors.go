@@ -0,0 +1,23 @@
+package metrics
+
+// Metrics recorded by the middlewares, the repository and the caches
+var (
+	HTTPRequests = NewCounterVec("http_requests_total",
+		"HTTP requests served, by route, method and status code.", "route", "method", "status")
+	HTTPRequestDuration = NewHistogramVec("http_request_duration_seconds",
+		"Latency of the HTTP requests, by route, method and status code.", DefaultBuckets, "route", "method", "status")
+	AuthFailures = NewCounterVec("auth_failures_total",
+		"Requests rejected by the authentication middleware, by reason.", "reason")
+	DBQueryDuration = NewHistogramVec("db_query_duration_seconds",
+		"Duration of the repository functions, by function.", DefaultBuckets, "function")
+	DBQueryErrors = NewCounterVec("db_query_errors_total",
+		"Repository functions that returned an error, by function.", "function")
+	DBQueryRetries = NewCounterVec("db_query_retries_total",
+		"Repository functions retried after a transient database error, by function.", "function")
+	CacheHits = NewCounterVec("cache_hits_total",
+		"Reads served from an in-process cache, by cache.", "cache")
+	CacheMisses = NewCounterVec("cache_misses_total",
+		"Reads not found in an in-process cache, by cache.", "cache")
+	CacheEvictions = NewCounterVec("cache_evictions_total",
+		"Values evicted from a full in-process cache, by cache.", "cache")
+)
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets Upper bounds in seconds of the latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metric Something written to the /metrics page
+type Metric interface {
+	Write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Metric
+)
+
+// register Add a metric to the ones written by WriteAll
+func register[M Metric](metric M) M {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, metric)
+	return metric
+}
+
+// WriteAll Write every registered metric in the text exposition format
+func WriteAll(w io.Writer) error {
+	registryMu.Lock()
+	metrics := append([]Metric(nil), registry...)
+	registryMu.Unlock()
+	for _, metric := range metrics {
+		if err := metric.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// series Values of a metric indexed by their label values
+type series[V any] struct {
+	mu     sync.Mutex
+	labels []string
+	values map[string]V
+	keys   map[string][]string
+}
+
+func newSeries[V any](labels []string) series[V] {
+	return series[V]{labels: labels, values: make(map[string]V), keys: make(map[string][]string)}
+}
+
+// get Get the value of the label values, creating it with create when missing, with the lock held
+func (s *series[V]) get(labelValues []string, create func() V) V {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(s.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	value, exists := s.values[key]
+	if !exists {
+		value = create()
+		s.values[key] = value
+		s.keys[key] = append([]string(nil), labelValues...)
+	}
+	return value
+}
+
+// sortedKeys Keys in a stable order, so consecutive scrapes are easy to diff
+func (s *series[V]) sortedKeys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec A counter per label values
+type CounterVec struct {
+	name string
+	help string
+	series[*float64]
+}
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return register(&CounterVec{name: name, help: help, series: newSeries[*float64](labels)})
+}
+
+// Inc Add one to the counter of the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(labelValues, func() *float64 { return new(float64) }) += value
+}
+
+func (c *CounterVec) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeHeader(w, c.name, c.help, "counter"); err != nil {
+		return err
+	}
+	for _, key := range c.sortedKeys() {
+		if err := writeSample(w, c.name, c.labels, c.keys[key], *c.values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec A histogram per label values
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	series[*histogram]
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return register(&HistogramVec{name: name, help: help, buckets: buckets, series: newSeries[*histogram](labels)})
+}
+
+// Observe Record a value in the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist := h.get(labelValues, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} })
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := writeHeader(w, h.name, h.help, "histogram"); err != nil {
+		return err
+	}
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range h.sortedKeys() {
+		hist, labelValues := h.values[key], h.keys[key]
+		for i, bound := range h.buckets {
+			err := writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), formatFloat(bound)), float64(hist.counts[i]))
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), "+Inf"), float64(hist.count)); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_sum", h.labels, labelValues, hist.sum); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_count", h.labels, labelValues, float64(hist.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGauge Write a gauge computed at scrape time
+func WriteGauge(w io.Writer, name string, help string, value float64) error {
+	if err := writeHeader(w, name, help, "gauge"); err != nil {
+		return err
+	}
+	return writeSample(w, name, nil, nil, value)
+}
+
+// WriteGaugeVec Write a gauge computed at scrape time with a value for each value of label
+func WriteGaugeVec(w io.Writer, name string, help string, label string, values map[string]float64) error {
+	if err := writeHeader(w, name, help, "gauge"); err != nil {
+		return err
+	}
+	labelValues := make([]string, 0, len(values))
+	for labelValue := range values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		if err := writeSample(w, name, []string{label}, []string{labelValue}, values[labelValue]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCounter Write a counter kept elsewhere, e.g. by sql.DB
+func WriteCounter(w io.Writer, name string, help string, value float64) error {
+	if err := writeHeader(w, name, help, "counter"); err != nil {
+		return err
+	}
+	return writeSample(w, name, nil, nil, value)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(w io.Writer, name string, help string, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, kind)
+	return err
+}
+
+func writeSample(w io.Writer, name string, labels []string, labelValues []string, value float64) error {
+	var line strings.Builder
+	line.WriteString(name)
+	if len(labels) > 0 {
+		line.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			fmt.Fprintf(&line, `%s="%s"`, label, labelEscaper.Replace(labelValues[i]))
+		}
+		line.WriteByte('}')
+	}
+	line.WriteByte(' ')
+	line.WriteString(formatFloat(value))
+	line.WriteByte('\n')
+	_, err := io.WriteString(w, line.String())
+	return err
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
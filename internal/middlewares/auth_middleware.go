@@ -1,95 +1,176 @@
 package middlewares
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"log/slog"
 	"net/http"
-	"os"
+	"openprogramschedule/internal/apikeys"
+	"openprogramschedule/internal/metrics"
+	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/repository"
+	"slices"
 	"strings"
-	"time"
 )
 
-type PublicUrl struct {
-	Url string
+// Anonymous Policy of routes callable without credentials
+const Anonymous = "anonymous"
+
+// Policies Scope required by each route, keyed by its "METHOD /path" pattern
+type Policies map[string]string
+
+// Scopes of the static keys configured through the environment
+var (
+	publicScopes  = []string{models.ScopeReadPrograms, models.ScopeReadSchedules}
+	editorScopes  = append(slices.Clone(publicScopes), models.ScopeReadUnpublished, models.ScopeWritePrograms, models.ScopeWriteHolidays, models.ScopeSubmitChanges)
+	managerScopes = append(slices.Clone(editorScopes), models.ScopeWriteSchedules, models.ScopeReviewChanges)
+)
+
+// Kinds of principal, which can share names, e.g. an API key named like the subject of a JWT
+const (
+	PrincipalAPIKey    = "api_key"
+	PrincipalStaticKey = "static_key"
+	PrincipalJWT       = "jwt"
+)
+
+// Principal The client a request was authenticated as
+type Principal struct {
+	Kind   string
+	Name   string
+	Scopes []string
 }
 
-var publicUrls = []PublicUrl{
-	{Url: "/programs/all"},
-	{Url: "/programs/get-by-id"},
-	{Url: "/programs/get-by-name"},
-	{Url: "/programs/get-by-category"},
-	{Url: "/schedules/all"},
-	{Url: "/schedules/get-by-program-id"},
-	{Url: "/schedules/get-by-id"},
-	{Url: "/schedules/get-by-day"},
-	{Url: "/schedules/get-by-date"},
+// ID Identify the principal among the ones of every kind
+func (principal *Principal) ID() string {
+	return principal.Kind + ":" + principal.Name
 }
 
+// HasScope Report whether the principal was granted a scope, admins are granted every scope
+func (principal *Principal) HasScope(scope string) bool {
+	return slices.Contains(principal.Scopes, models.ScopeAdmin) || slices.Contains(principal.Scopes, scope)
+}
+
+type principalKey struct{}
+
 const (
-	successMessage      = "Operation completed successfully"
 	noAuthHeaderMessage = "Authorization header missing"
 	noBearerMessage     = "Invalid Authorization header format"
 	invalidTokenMessage = "Invalid token"
+	forbiddenMessage    = "Insufficient scope"
 )
 
-func isPathPublicUrl(path string) bool {
-	for _, publicUrl := range publicUrls {
-		if publicUrl.Url == path {
-			return true
+// StaticKeys Keys of each role configured at startup, empty keys are disabled
+type StaticKeys struct {
+	Admin   string
+	Manager string
+	Private string
+	Public  string
+}
+
+// authenticate Get the principal of a client key or JWT, nil if the key is unknown, revoked or expired or the JWT is invalid
+func authenticate(ctx context.Context, clientKey string, db *sql.DB, jwtValidator *JWTValidator, keys StaticKeys) (*Principal, error) {
+	if jwtValidator != nil && IsJWT(clientKey) {
+		principal, err := jwtValidator.Authenticate(clientKey)
+		if err != nil {
+			slog.WarnContext(ctx, "Invalid JWT", "error", err)
+			return nil, nil
+		}
+		return principal, nil
+	}
+
+	if prefix, secret, ok := apikeys.Parse(clientKey); ok {
+		credentials, err := repository.GetApiKeyCredentials(ctx, prefix, db)
+		if err != nil || credentials == nil {
+			return nil, err
 		}
+		if !apikeys.Verify(secret, credentials.SecretHash) && !apikeys.Verify(secret, credentials.PreviousSecretHash) {
+			return nil, nil
+		}
+		return &Principal{Kind: PrincipalAPIKey, Name: credentials.Key.Name, Scopes: credentials.Key.Scopes}, nil
+	}
+
+	switch {
+	case apikeys.Equal(clientKey, keys.Admin):
+		return &Principal{Kind: PrincipalStaticKey, Name: "admin", Scopes: []string{models.ScopeAdmin}}, nil
+	case apikeys.Equal(clientKey, keys.Manager):
+		return &Principal{Kind: PrincipalStaticKey, Name: "manager", Scopes: managerScopes}, nil
+	case apikeys.Equal(clientKey, keys.Private):
+		return &Principal{Kind: PrincipalStaticKey, Name: "editor", Scopes: editorScopes}, nil
+	case apikeys.Equal(clientKey, keys.Public):
+		return &Principal{Kind: PrincipalStaticKey, Name: "public", Scopes: publicScopes}, nil
 	}
-	return false
+	return nil, nil
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware Authenticate requests with static keys, API keys or, when jwtValidator is not nil, JWTs,
+// and authorize them against the policy of the route the mux matches
+func AuthMiddleware(next http.Handler, mux *http.ServeMux, policies Policies, db *sql.DB, jwtValidator *JWTValidator, keys StaticKeys) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		method := r.Method
-		path := r.URL.Path
-		userAgent := r.UserAgent()
-		remoteAddr := r.RemoteAddr
+		// Unmatched requests are left to the mux, which answers 404 or 405
+		_, pattern := mux.Handler(r)
+		scope, exists := policies[pattern]
+		if pattern == "" || scope == Anonymous {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Handlers registered on the mux without a policy are restricted to admins
+		if !exists {
+			scope = models.ScopeAdmin
+		}
 
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-				method, path, userAgent, remoteAddr, start.Format(time.RFC3339), noAuthHeaderMessage)
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			slog.WarnContext(r.Context(), "Request rejected", "reason", noAuthHeaderMessage)
+			metrics.AuthFailures.Inc("missing_header")
+			problem.Write(w, r, http.StatusUnauthorized, "unauthorized", noAuthHeaderMessage)
 			return
 		}
 
-		privateKey := os.Getenv("PRIVATE_KEY")
-		publicApiKey := os.Getenv("PUBLIC_API_KEY")
-
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-				method, path, userAgent, remoteAddr, start.Format(time.RFC3339), noBearerMessage)
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+			slog.WarnContext(r.Context(), "Request rejected", "reason", noBearerMessage)
+			metrics.AuthFailures.Inc("invalid_header")
+			problem.Write(w, r, http.StatusUnauthorized, "invalid_authorization_header", noBearerMessage)
 			return
 		}
 		clientKey := strings.TrimPrefix(authHeader, "Bearer ")
 
-		if isPathPublicUrl(r.URL.Path) {
-			if clientKey != publicApiKey {
-				log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-					method, path, userAgent, remoteAddr, start.Format(time.RFC3339), invalidTokenMessage)
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-				return
-			}
-			log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-				method, path, userAgent, remoteAddr, start.Format(time.RFC3339), successMessage)
-			next.ServeHTTP(w, r)
+		principal, err := authenticate(r.Context(), clientKey, db, jwtValidator, keys)
+		if err != nil {
+			// A database down gets 503 and Retry-After, as in the handlers
+			slog.WarnContext(r.Context(), "Error during authentication", "error", err)
+			metrics.AuthFailures.Inc("error")
+			problem.WriteError(w, r, err)
+			return
+		}
+		if principal == nil {
+			slog.WarnContext(r.Context(), "Request rejected", "reason", invalidTokenMessage)
+			metrics.AuthFailures.Inc("invalid_token")
+			problem.Write(w, r, http.StatusUnauthorized, "invalid_token", invalidTokenMessage)
 			return
 		}
 
-		if clientKey != privateKey {
-			log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-				method, path, userAgent, remoteAddr, start.Format(time.RFC3339), invalidTokenMessage)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if !principal.HasScope(scope) {
+			slog.WarnContext(r.Context(), "Request rejected", "reason", forbiddenMessage, "principal", principal.Name, "scope", scope)
+			metrics.AuthFailures.Inc("insufficient_scope")
+			problem.Write(w, r, http.StatusForbidden, "insufficient_scope", forbiddenMessage)
 			return
 		}
 
-		log.Printf("Method: %s, Path: %s, User-Agent: %s, RemoteAddr: %s, Timestamp: %s, Status: %s",
-			method, path, userAgent, remoteAddr, start.Format(time.RFC3339), successMessage)
+		slog.DebugContext(r.Context(), "Request authenticated", "principal", principal.Name, "scope", scope)
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
 	})
 }
+
+// RequestPrincipal Get the principal the request was authenticated as, nil for unauthenticated requests
+func RequestPrincipal(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// IsPrivateRequest Report whether the request may see unpublished and embargoed content
+func IsPrivateRequest(r *http.Request) bool {
+	principal := RequestPrincipal(r)
+	return principal != nil && principal.HasScope(models.ScopeReadUnpublished)
+}
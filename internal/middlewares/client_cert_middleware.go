@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/metrics"
+	"openprogramschedule/internal/problem"
+)
+
+const clientCertMessage = "Client certificate required"
+
+// ClientCertMiddleware Require a verified client certificate on the write endpoints, i.e. any matched route whose method
+// is not GET or HEAD. The certificate is verified against the client CAs by the TLS handshake, on top of the Authorization header
+func ClientCertMiddleware(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			slog.WarnContext(r.Context(), "Request rejected", "reason", clientCertMessage)
+			metrics.AuthFailures.Inc("missing_client_cert")
+			problem.Write(w, r, http.StatusForbidden, "client_certificate_required", clientCertMessage)
+			return
+		}
+		slog.DebugContext(r.Context(), "Client certificate verified", "subject", r.TLS.VerifiedChains[0][0].Subject.String())
+		next.ServeHTTP(w, r)
+	})
+}
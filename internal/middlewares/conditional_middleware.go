@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/repository"
+	"strings"
+	"time"
+)
+
+// routeTables Tables whose data the routes of each group serve. The GET routes of the other groups are not conditional
+var routeTables = map[string][]string{
+	"programs": {repository.TablePrograms},
+	// Schedules are hidden along with their embargoed program and changed by the holidays on date queries
+	"schedules":       {repository.TablePrograms, repository.TableSchedules, repository.TableHolidays, repository.TableHolidaySubstitutions},
+	"holidays":        {repository.TableHolidays, repository.TableHolidaySubstitutions},
+	"change-requests": {repository.TableChangeRequests},
+}
+
+const (
+	// defaultCacheControl Cache-Control of the public responses of the routes without a configured one, to be revalidated
+	defaultCacheControl = "no-cache"
+	// privateCacheControl Cache-Control of the responses to private requests, which may hold unpublished content
+	privateCacheControl = "private, no-cache"
+)
+
+// ConditionalMiddleware Give the GET responses of the versioned route groups an ETag and a Last-Modified computed from
+// the version of the data they serve, and answer 304 Not Modified, without querying the data, when the copy of the
+// client is still current. The handlers only get cached reads of the same data version. cacheControl maps route paths
+// to the Cache-Control of their public responses, e.g. "/schedules/all" to "public, max-age=60", private requests
+// never being stored by shared caches
+func ConditionalMiddleware(next http.Handler, mux *http.ServeMux, cacheControl map[string]string, database *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		tables := routeTables[routeGroup(pattern)]
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || tables == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version, err := repository.GetDataVersion(r.Context(), tables, database)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Serving without validators", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		tagged := &taggedWriter{
+			ResponseWriter: w,
+			tag:            version.Tag,
+			lastModified:   version.Modified.Format(http.TimeFormat),
+			cacheControl:   defaultCacheControl,
+		}
+		if control, found := cacheControl[r.URL.Path]; found {
+			tagged.cacheControl = control
+		}
+		if IsPrivateRequest(r) {
+			tagged.tag = "p" + tagged.tag
+			tagged.cacheControl = privateCacheControl
+		}
+		// Public and private requests get different content from the same URL
+		w.Header().Add("Vary", "Authorization")
+
+		if etag, notModified := checkNotModified(r, tagged.tag, version.Modified); notModified {
+			tagged.setHeaders(etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next.ServeHTTP(tagged, r.WithContext(repository.WithDataTag(r.Context(), version.Tag)))
+	})
+}
+
+// IsConditionalRoute Report whether path names a GET route served by ConditionalMiddleware, to check the configured
+// Cache-Control of each route
+func IsConditionalRoute(policies Policies, path string) bool {
+	pattern := http.MethodGet + " " + path
+	_, found := policies[pattern]
+	return found && routeTables[routeGroup(pattern)] != nil
+}
+
+// checkNotModified Report whether the copy of the client is current, along with its ETag, empty when only its date
+// is known. If-Modified-Since is only looked at without If-None-Match. An entity tag matches when its data tag, after
+// the row version of a single resource, is tag, weak tags included
+func checkNotModified(r *http.Request, tag string, modified time.Time) (string, bool) {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, etag := range strings.Split(header, ",") {
+			etag = strings.TrimSpace(etag)
+			value := strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+			if _, dataTag, found := strings.Cut(value, "-"); found {
+				value = dataTag
+			}
+			if etag == "*" || value == tag {
+				return etag, true
+			}
+		}
+		return "", false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return "", err == nil && !modified.After(since)
+}
+
+// taggedWriter Set the validators and the Cache-Control of successful responses. The ETag set by the handler, the row
+// version of a single resource, gets the data tag appended, so it still works in If-Match
+type taggedWriter struct {
+	http.ResponseWriter
+	tag          string
+	lastModified string
+	cacheControl string
+	wroteHeader  bool
+}
+
+func (w *taggedWriter) setHeaders(etag string) {
+	header := w.Header()
+	if etag != "" && etag != "*" {
+		header.Set("ETag", etag)
+	}
+	header.Set("Last-Modified", w.lastModified)
+	header.Set("Cache-Control", w.cacheControl)
+}
+
+func (w *taggedWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK {
+			etag := w.tag
+			if version := strings.Trim(w.Header().Get("ETag"), `"`); version != "" {
+				etag = version + "-" + etag
+			}
+			w.setHeaders(`"` + etag + `"`)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *taggedWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *taggedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig Cross-origin requests allowed by the API, an origin of "*" allows every origin
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (config CORSConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(config.AllowedOrigins, "*") || slices.Contains(config.AllowedOrigins, origin)
+}
+
+func (config CORSConfig) allowsHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		if !slices.ContainsFunc(config.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// CORSMiddleware Add the CORS headers to the responses to allowed origins and answer their preflights,
+// which carry no credentials and so never reach the authentication
+func CORSMiddleware(next http.Handler, mux *http.ServeMux, config CORSConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !config.allowsOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Credentials are only allowed to the origins listed by name, never through "*", which would let any site
+		// send requests with the credentials of the user. Those origins are echoed, browsers reject "*" with credentials
+		credentials := config.AllowCredentials && slices.Contains(config.AllowedOrigins, origin)
+		allowedOrigin := origin
+		if !credentials && slices.Contains(config.AllowedOrigins, "*") {
+			allowedOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		if credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || requestedMethod == "" {
+			if len(config.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight, answered only for routes that exist with the requested method
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		preflighted := r.Clone(r.Context())
+		preflighted.Method = requestedMethod
+		if _, pattern := mux.Handler(preflighted); pattern == "" ||
+			!slices.Contains(config.AllowedMethods, requestedMethod) ||
+			!config.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			w.Header().Del("Access-Control-Allow-Origin")
+			w.Header().Del("Access-Control-Allow-Credentials")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
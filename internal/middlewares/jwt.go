@@ -0,0 +1,238 @@
+package middlewares
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"openprogramschedule/internal/models"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwtLeeway Tolerated clock skew with the identity provider
+const jwtLeeway = time.Minute
+
+// minRSAKeyBits Smallest RSA modulus accepted in the JWKS file
+const minRSAKeyBits = 2048
+
+// JWT roles and the scopes they grant
+var jwtRoleScopes = map[string][]string{
+	"viewer": publicScopes,
+	"editor": editorScopes,
+	"admin":  {models.ScopeAdmin},
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwtKey struct {
+	id      string
+	alg     string
+	hmacKey []byte
+	rsaKey  *rsa.PublicKey
+}
+
+// JWTValidator Validate HS256 and RS256 JWTs issued by the partners identity provider
+type JWTValidator struct {
+	keys       []jwtKey
+	issuer     string
+	audience   string
+	rolesClaim string
+}
+
+// NewJWTValidator Load the signing keys from a local JWKS file. The issuer and audience are required, so the tokens the
+// identity provider issues to other services are not accepted
+func NewJWTValidator(jwksFile string, issuer string, audience string, rolesClaim string) (*JWTValidator, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("the expected issuer and audience are required")
+	}
+	data, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file: %v", err)
+	}
+
+	validator := &JWTValidator{issuer: issuer, audience: audience, rolesClaim: rolesClaim}
+	if validator.rolesClaim == "" {
+		validator.rolesClaim = "roles"
+	}
+	for _, key := range jwks.Keys {
+		switch key.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("invalid oct key %q in JWKS file", key.Kid)
+			}
+			validator.keys = append(validator.keys, jwtKey{id: key.Kid, alg: "HS256", hmacKey: secret})
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(key.N)
+			e, errE := base64.RawURLEncoding.DecodeString(key.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+				return nil, fmt.Errorf("invalid RSA key %q in JWKS file", key.Kid)
+			}
+			publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if publicKey.N.BitLen() < minRSAKeyBits {
+				return nil, fmt.Errorf("RSA key %q in JWKS file is shorter than %d bits", key.Kid, minRSAKeyBits)
+			}
+			validator.keys = append(validator.keys, jwtKey{id: key.Kid, alg: "RS256", rsaKey: publicKey})
+		default:
+			continue
+		}
+		if key.Alg != "" && key.Alg != validator.keys[len(validator.keys)-1].alg {
+			return nil, fmt.Errorf("key %q in JWKS file has unsupported alg %s", key.Kid, key.Alg)
+		}
+	}
+	if len(validator.keys) == 0 {
+		return nil, errors.New("no HS256 or RS256 key found in JWKS file")
+	}
+	return validator, nil
+}
+
+// IsJWT Report whether a bearer token is a JWT rather than a static key: three base64url segments, the first one a JSON
+// header naming its alg
+func IsJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	return decodeSegment(parts[0], &header) == nil && header.Alg != ""
+}
+
+// Authenticate Validate a JWT and get the principal of its subject, with the scopes of its roles
+func (validator *JWTValidator) Authenticate(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+	if err = validator.verify(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %v", err)
+	}
+	if err = validator.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Kind: PrincipalJWT, Name: "jwt"}
+	if subject, ok := claims["sub"].(string); ok && subject != "" {
+		principal.Name = subject
+	}
+	for _, role := range stringsClaim(claims[validator.rolesClaim]) {
+		for _, scope := range jwtRoleScopes[role] {
+			if !slices.Contains(principal.Scopes, scope) {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+	}
+	if len(principal.Scopes) == 0 {
+		return nil, errors.New("no known role in token")
+	}
+	return principal, nil
+}
+
+// verify Check the signature with a key matching both the kid and the alg, so an RSA public key is never used as an HMAC secret
+func (validator *JWTValidator) verify(alg string, kid string, signingInput string, signature []byte) error {
+	for _, key := range validator.keys {
+		if key.alg != alg || (kid != "" && key.id != kid) {
+			continue
+		}
+		switch alg {
+		case "HS256":
+			mac := hmac.New(sha256.New, key.hmacKey)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		case "RS256":
+			digest := sha256.Sum256([]byte(signingInput))
+			if rsa.VerifyPKCS1v15(key.rsaKey, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid signature for alg %q and kid %q", alg, kid)
+}
+
+func (validator *JWTValidator) validateClaims(claims map[string]any) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+	if claims["iss"] != validator.issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !slices.Contains(stringsClaim(claims["aud"]), validator.audience) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stringsClaim Read a claim holding either a string or an array of strings
+func stringsClaim(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
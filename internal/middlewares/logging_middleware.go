@@ -0,0 +1,104 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/logging"
+	"time"
+)
+
+// maxRequestIDLength Longer X-Request-ID headers are replaced, so clients cannot bloat the logs
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware Accept the X-Request-ID of the client or generate one, echo it in the response and attach it to the request context
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// isValidRequestID Accept printable ASCII IDs only, so they cannot forge log lines
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// responseRecorder Record the status code and the bytes written by the handlers
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	n, err := recorder.ResponseWriter.Write(data)
+	recorder.bytes += n
+	return n, err
+}
+
+// Flush Keep the event stream working through the recorder
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// AccessLogMiddleware Log every request once it is served, with its status code, latency and bytes written
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes", recorder.bytes,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"openprogramschedule/internal/metrics"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute Route label of the requests matching no route, so unknown paths cannot grow the number of series
+const unmatchedRoute = "unmatched"
+
+// knownMethods Methods used as labels as they are, any other is counted as other
+var knownMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions}
+
+// MetricsMiddleware Count the requests and record their latency, by route pattern, method and status code
+func MetricsMiddleware(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := unmatchedRoute
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		method := r.Method
+		if !slices.Contains(knownMethods, method) {
+			method = "other"
+		}
+		status := strconv.Itoa(recorder.status)
+		metrics.HTTPRequests.Inc(route, method, status)
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, method, status)
+	})
+}
@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"openprogramschedule/internal/problem"
+	"openprogramschedule/internal/ratelimit"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rateLimitedMessage = "Rate limit exceeded"
+
+type ipDecisionKey struct{}
+
+// RateLimitMiddleware Throttle requests per client IP, with the limit of the route group they match. It runs before
+// AuthMiddleware, so floods of invalid credentials are throttled before their keys are looked up.
+// The X-Forwarded-For header is only trusted when trustProxy is set, i.e. when the server sits behind a reverse proxy
+func RateLimitMiddleware(next http.Handler, mux *http.ServeMux, limiter *ratelimit.Limiter, trustProxy bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r, trustProxy)
+		decision := limiter.AllowIP(routeGroup(pattern), ip)
+		if !writeDecision(w, r, decision, "", ip) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ipDecisionKey{}, decision)))
+	})
+}
+
+// ClientRateLimitMiddleware Throttle the requests AuthMiddleware let through per principal, and count them against the
+// daily quota of the principal, or of the client IP for unauthenticated requests
+func ClientRateLimitMiddleware(next http.Handler, mux *http.ServeMux, limiter *ratelimit.Limiter, trustProxy bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r, trustProxy)
+		var key string
+		if principal := RequestPrincipal(r); principal != nil {
+			key = principal.ID()
+		}
+		decision := limiter.AllowClient(routeGroup(pattern), ip, key)
+		// The headers describe the most restrictive limit, the IP one set them already when it is lower
+		if ipDecision, ok := r.Context().Value(ipDecisionKey{}).(ratelimit.Decision); ok && decision.Allowed &&
+			ipDecision.Limit > 0 && (decision.Limit == 0 || ipDecision.Remaining < decision.Remaining) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !writeDecision(w, r, decision, key, ip) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeDecision Set the RateLimit headers of a decision, answering 429 and returning false when it rejects the request
+func writeDecision(w http.ResponseWriter, r *http.Request, decision ratelimit.Decision, key string, ip string) bool {
+	if decision.Limit > 0 {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(decision.Remaining, 0)))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	}
+	if !decision.Allowed {
+		slog.WarnContext(r.Context(), "Request rejected", "reason", rateLimitedMessage, "principal", key, "client_ip", ip)
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+		problem.Write(w, r, http.StatusTooManyRequests, "rate_limited", rateLimitedMessage)
+		return false
+	}
+	return true
+}
+
+// routeGroup Get the group of a route, the first segment of its path, e.g. schedules for "GET /schedules/all"
+func routeGroup(pattern string) string {
+	_, path, _ := strings.Cut(pattern, " ")
+	group, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return group
+}
+
+// clientIP Get the IP of the client, the leftmost X-Forwarded-For address when the proxy is trusted
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,40 @@
+package models
+
+// Scopes granted to API keys. The admin scope grants every other scope
+const (
+	ScopeReadPrograms    = "read:programs"
+	ScopeWritePrograms   = "write:programs"
+	ScopeReadSchedules   = "read:schedules"
+	ScopeWriteSchedules  = "write:schedules"
+	ScopeReadUnpublished = "read:unpublished"
+	ScopeWriteHolidays   = "write:holidays"
+	ScopeSubmitChanges   = "submit:changes"
+	ScopeReviewChanges   = "review:changes"
+	ScopeReadMetrics     = "read:metrics"
+	ScopeAdmin           = "admin"
+)
+
+var Scopes = []string{
+	ScopeReadPrograms,
+	ScopeWritePrograms,
+	ScopeReadSchedules,
+	ScopeWriteSchedules,
+	ScopeReadUnpublished,
+	ScopeWriteHolidays,
+	ScopeSubmitChanges,
+	ScopeReviewChanges,
+	ScopeReadMetrics,
+	ScopeAdmin,
+}
+
+// ApiKey Secrets are never stored nor returned, except once right after creation or rotation
+type ApiKey struct {
+	Id        *uint    `json:"id"`
+	Name      string   `json:"name"`
+	Prefix    string   `json:"prefix"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt *string  `json:"created_at,omitempty"`
+	ExpiresAt *string  `json:"expires_at,omitempty"`
+	RevokedAt *string  `json:"revoked_at,omitempty"`
+	RotatedAt *string  `json:"rotated_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// Change request actions and statuses
+const (
+	ChangeActionAdd    = "add"
+	ChangeActionUpdate = "update"
+	ChangeActionDelete = "delete"
+
+	ChangeStatusPending  = "pending"
+	ChangeStatusApproved = "approved"
+	ChangeStatusRejected = "rejected"
+)
+
+// ChangeRequest A schedule change submitted by an editor, applied only once a manager approves it
+type ChangeRequest struct {
+	Id            *uint     `json:"id"`
+	Action        string    `json:"action"`
+	ScheduleId    *uint     `json:"schedule_id,omitempty"`
+	Schedule      *Schedule `json:"schedule,omitempty"`
+	Comment       string    `json:"comment"`
+	Status        string    `json:"status"`
+	SubmittedBy   string    `json:"submitted_by"`
+	SubmittedAt   *string   `json:"submitted_at,omitempty"`
+	ReviewedBy    *string   `json:"reviewed_by,omitempty"`
+	ReviewedAt    *string   `json:"reviewed_at,omitempty"`
+	ReviewComment *string   `json:"review_comment,omitempty"`
+}
+
+// ChangeReview A manager decision on a change request
+type ChangeReview struct {
+	ReviewedBy string `json:"reviewed_by"`
+	Comment    string `json:"comment"`
+}
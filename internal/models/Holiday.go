@@ -0,0 +1,20 @@
+package models
+
+// Holiday Recurring holidays fall on the same month and day every year. LineupDay (1 for Monday, 7 for Sunday) swaps the lineup for that weekday's one
+type Holiday struct {
+	Id            *uint                 `json:"id"`
+	Name          string                `json:"name"`
+	Date          string                `json:"date"`
+	Country       string                `json:"country"`
+	Region        *string               `json:"region,omitempty"`
+	Recurring     bool                  `json:"recurring"`
+	LineupDay     *int                  `json:"lineup_day,omitempty"`
+	Substitutions []HolidaySubstitution `json:"substitutions"`
+}
+
+// HolidaySubstitution Program FromProgramId is replaced by ToProgramId on the holiday
+type HolidaySubstitution struct {
+	Id            *uint `json:"id"`
+	FromProgramId uint  `json:"from_program_id"`
+	ToProgramId   uint  `json:"to_program_id"`
+}
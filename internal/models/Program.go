@@ -2,10 +2,13 @@ package models
 
 // Program Pointer allows null value
 type Program struct {
-	Id           *uint  `json:"id"`
-	Name         string `json:"name"`
-	Description  string `json:"description"`
-	Host         string `json:"host"`
-	Category     string `json:"category"`
-	InProduction *bool  `json:"in_production"`
+	Id           *uint      `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Host         string     `json:"host"`
+	Category     string     `json:"category"`
+	InProduction *bool      `json:"in_production"`
+	PublishAt    *Timestamp `json:"publish_at,omitempty"`
+	// Version Row version, changing with every write, sent back in If-Match
+	Version uint64 `json:"version"`
 }
@@ -1,9 +1,33 @@
 package models
 
+// Schedule statuses. Drafts become published and then aired, drafts and published schedules can be cancelled
+const (
+	ScheduleStatusDraft     = "draft"
+	ScheduleStatusPublished = "published"
+	ScheduleStatusCancelled = "cancelled"
+	ScheduleStatusAired     = "aired"
+)
+
+// DaysOfTheWeek Day of the schedules, from Monday to Sunday. Days are in italian
+var DaysOfTheWeek = []string{"Lunedi", "Martedi", "Mercoledi", "Giovedi", "Venerdi", "Sabato", "Domenica"}
+
+// Schedule Override schedules preempt the regular schedules airing between Date and EndDate
 type Schedule struct {
-	Id          *uint  `json:"id"`
-	ProgramId   uint   `json:"program_id"`
-	Description string `json:"description"`
-	Day         string `json:"day"`
-	Date        string `json:"date"`
+	Id               *uint      `json:"id"`
+	ProgramId        uint       `json:"program_id"`
+	Description      string     `json:"description"`
+	Day              string     `json:"day"`
+	Date             Timestamp  `json:"date"`
+	EndDate          *Timestamp `json:"end_date,omitempty"`
+	IsOverride       bool       `json:"is_override"`
+	OverrideReason   *string    `json:"override_reason,omitempty"`
+	Status           string     `json:"status"`
+	PublishAt        *Timestamp `json:"publish_at,omitempty"`
+	Preempted        bool       `json:"preempted"`
+	PreemptedBy      *uint      `json:"preempted_by,omitempty"`
+	PreemptionReason *string    `json:"preemption_reason,omitempty"`
+	Holiday          *string    `json:"holiday,omitempty"`
+	SubstitutedFor   *uint      `json:"substituted_for,omitempty"`
+	// Version Row version, changing with every write, sent back in If-Match
+	Version uint64 `json:"version"`
 }
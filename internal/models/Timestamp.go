@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timestamp A time written in JSON as RFC 3339 with its offset, e.g. 2024-12-06T12:00:00Z, and stored in UTC. Input is
+// parsed strictly, malformed and impossible dates such as 2024-02-30T12:00:00Z are kept as a parse error for the
+// validators to report along with the other invalid fields
+type Timestamp struct {
+	time.Time
+	err error
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Format(time.RFC3339))
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.err = errors.New("expected a string")
+		return nil
+	}
+	t.Time, t.err = time.Parse(time.RFC3339, value)
+	return nil
+}
+
+// ParseError Get the error of the input that could not be parsed, nil when it was valid
+func (t Timestamp) ParseError() error {
+	return t.err
+}
+
+// Value Store the time in UTC, as the DATETIME columns have no offset
+func (t Timestamp) Value() (driver.Value, error) {
+	return t.UTC(), nil
+}
+
+// Scan Read a DATETIME column, whose times are in UTC
+func (t *Timestamp) Scan(src any) error {
+	value, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into a Timestamp", src)
+	}
+	t.Time = time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), value.Nanosecond(), time.UTC)
+	return nil
+}
@@ -0,0 +1,296 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"openprogramschedule/internal/apperrors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch documents
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedMediaType The request body is neither a merge patch nor a JSON Patch
+var ErrUnsupportedMediaType = errors.New("unsupported patch media type")
+
+// Apply Apply a patch document of the given Content-Type to a JSON document. Plain application/json bodies are merge
+// patches, bodies without a Content-Type are refused. Malformed patches are validation errors, patches that do not apply to the document, e.g. a failed test
+// operation, are conflicts
+func Apply(contentType string, document []byte, patch []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	var target any
+	if err = json.Unmarshal(document, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	switch mediaType {
+	case MergePatchType, "application/json":
+		var mergePatch any
+		if err = json.Unmarshal(patch, &mergePatch); err != nil {
+			return nil, apperrors.Validation("invalid_patch", fmt.Sprintf("Invalid merge patch: %v", err))
+		}
+		target = MergePatch(target, mergePatch)
+	case JSONPatchType:
+		var operations []Operation
+		if err = json.Unmarshal(patch, &operations); err != nil {
+			return nil, apperrors.Validation("invalid_patch", fmt.Sprintf("Invalid JSON Patch: %v", err))
+		}
+		if target, err = JSONPatch(target, operations); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+	return json.Marshal(target)
+}
+
+// MergePatch Apply a JSON merge patch (RFC 7396): members of patch objects replace the ones of target, recursively,
+// null members remove them and any other patch replaces target
+func MergePatch(target any, patch any) any {
+	patchObject, isObject := patch.(map[string]any)
+	if !isObject {
+		return patch
+	}
+	targetObject, isObject := target.(map[string]any)
+	if !isObject {
+		targetObject = make(map[string]any, len(patchObject))
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = MergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// Operation An operation of a JSON Patch (RFC 6902). Value is kept raw so a null value can be told from a missing one
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch Apply the operations of a JSON Patch (RFC 6902) in order, failing on the first one that does not apply
+func JSONPatch(target any, operations []Operation) (any, error) {
+	for _, operation := range operations {
+		var err error
+		if target, err = apply(target, operation); err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+func apply(target any, operation Operation) (any, error) {
+	invalid := func(format string, args ...any) error {
+		return apperrors.Validation("invalid_patch", fmt.Sprintf("Invalid JSON Patch operation %s %s: %s", operation.Op, operation.Path, fmt.Sprintf(format, args...)))
+	}
+	conflict := func(err error) error {
+		return apperrors.Conflict("patch_conflict", fmt.Sprintf("JSON Patch operation %s %s does not apply: %v", operation.Op, operation.Path, err))
+	}
+
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	var value any
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, invalid("value is missing")
+		}
+		if err = json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, invalid("%v", err)
+		}
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, invalid("from: %v", err)
+		}
+		if operation.Op == "move" && isPrefix(from, path) && len(from) < len(path) {
+			return nil, invalid("a value cannot be moved into itself")
+		}
+		if value, err = get(target, from); err != nil {
+			return nil, conflict(err)
+		}
+		if operation.Op == "move" {
+			if target, err = remove(target, from); err != nil {
+				return nil, conflict(err)
+			}
+		} else {
+			value = deepCopy(value)
+		}
+	case "remove":
+	default:
+		return nil, invalid("unknown operation")
+	}
+
+	switch operation.Op {
+	case "add", "move", "copy":
+		target, err = add(target, path, value, false)
+	case "replace":
+		target, err = add(target, path, value, true)
+	case "remove":
+		target, err = remove(target, path)
+	case "test":
+		var current any
+		if current, err = get(target, path); err == nil && !reflect.DeepEqual(current, value) {
+			err = errors.New("test failed")
+		}
+	}
+	if err != nil {
+		return nil, conflict(err)
+	}
+	return target, nil
+}
+
+// parsePointer Split a JSON Pointer (RFC 6901) into its unescaped tokens, the empty pointer being the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	return len(prefix) <= len(path) && reflect.DeepEqual(prefix, path[:len(prefix)])
+}
+
+// index Get the index of an array element, size being valid only when appending
+func index(token string, size int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > size || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func get(target any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := target.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			target = value
+		case []any:
+			i, err := index(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			target = container[i]
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	}
+	return target, nil
+}
+
+// add Set the value at path, inserting into arrays unless replacing. Replaced values must exist
+func add(target any, path []string, value any, replace bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(target, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		if _, exists := container[token]; replace && !exists {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		container[token] = value
+		return target, nil
+	case []any:
+		var i int
+		switch {
+		case token == "-" && !replace:
+			i = len(container)
+		case replace:
+			i, err = index(token, len(container)-1)
+		default:
+			i, err = index(token, len(container))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if replace {
+			container[i] = value
+			return target, nil
+		}
+		container = append(container[:i], append([]any{value}, container[i:]...)...)
+		return add(target, path[:len(path)-1], container, true)
+	default:
+		return nil, fmt.Errorf("%q is not in an object or array", token)
+	}
+}
+
+func remove(target any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the whole document cannot be removed")
+	}
+	parent, err := get(target, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		if _, exists := container[token]; !exists {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		delete(container, token)
+		return target, nil
+	case []any:
+		i, err := index(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container = append(container[:i:i], container[i+1:]...)
+		return add(target, path[:len(path)-1], container, true)
+	default:
+		return nil, fmt.Errorf("%q is not in an object or array", token)
+	}
+}
+
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for name, member := range value {
+			copied[name] = deepCopy(member)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, element := range value {
+			copied[i] = deepCopy(element)
+		}
+		return copied
+	default:
+		return value
+	}
+}
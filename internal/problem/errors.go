@@ -0,0 +1,65 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/patch"
+)
+
+// ErrServerShutdown Cause of the cancellation of the requests still running once the shutdown timeout has elapsed
+var ErrServerShutdown = errors.New("server shutting down")
+
+// StatusClientClosedRequest Non-standard status of the requests whose client went away before the response
+const StatusClientClosedRequest = 499
+
+// errorStatuses Status of each kind of application error
+var errorStatuses = map[error]int{
+	apperrors.ErrNotFound:           http.StatusNotFound,
+	apperrors.ErrConflict:           http.StatusConflict,
+	apperrors.ErrValidation:         http.StatusBadRequest,
+	apperrors.ErrUnavailable:        http.StatusServiceUnavailable,
+	apperrors.ErrPreconditionFailed: http.StatusPreconditionFailed,
+}
+
+// WriteError Write the problem+json response to an error. Application errors get the status of their kind along with
+// their code and message, interrupted queries get 503, or 499 when the client went away, patches of an unknown media type
+// get 415, bodies over their limit 413, and any other error is logged and reported as an internal error without its
+// details. Handlers and middlewares report every error through it
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *apperrors.Error
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &appErr):
+		status := errorStatuses[appErr.Kind]
+		if status == http.StatusServiceUnavailable {
+			slog.ErrorContext(r.Context(), "Dependency unavailable", "error", err)
+			w.Header().Set("Retry-After", "1")
+		}
+		details := New(r, status, appErr.Code, appErr.Message)
+		details.Errors = appErr.Fields
+		WriteDetails(w, r, details)
+	case errors.Is(err, ErrServerShutdown):
+		slog.WarnContext(r.Context(), "Query cancelled by the shutdown", "error", err)
+		w.Header().Set("Retry-After", "1")
+		Write(w, r, http.StatusServiceUnavailable, "shutting_down", "The server is shutting down, retry later")
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.WarnContext(r.Context(), "Query timed out", "error", err)
+		w.Header().Set("Retry-After", "1")
+		Write(w, r, http.StatusServiceUnavailable, "timeout", "The request timed out, retry later")
+	case errors.Is(err, context.Canceled):
+		slog.InfoContext(r.Context(), "Query cancelled by the client", "error", err)
+		w.WriteHeader(StatusClientClosedRequest)
+	case errors.Is(err, patch.ErrUnsupportedMediaType):
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		Write(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "Patches must be "+patch.MergePatchType+" or "+patch.JSONPatchType)
+	case errors.As(err, &tooLarge):
+		Write(w, r, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("The request body must not exceed %d bytes", tooLarge.Limit))
+	default:
+		slog.ErrorContext(r.Context(), "Error during operation", "error", err)
+		Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+	}
+}
@@ -0,0 +1,54 @@
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/logging"
+)
+
+// ContentType Media type of the error responses, from RFC 7807
+const ContentType = "application/problem+json"
+
+// Details Body of an error response. Code is a stable machine-readable identifier of the error, clients should
+// match it rather than Title or Detail
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors Invalid fields of the request, if any
+	Errors []apperrors.FieldError `json:"errors,omitempty"`
+}
+
+// New Get the details of an error response to a request
+func New(r *http.Request, status int, code string, detail string) Details {
+	return Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: logging.RequestID(r.Context()),
+	}
+}
+
+// Write Write an error response as application/problem+json
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	WriteDetails(w, r, New(r, status, code, detail))
+}
+
+// WriteDetails Write an error response with the given details
+func WriteDetails(w http.ResponseWriter, r *http.Request, details Details) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(details.Status)
+	if err := json.NewEncoder(w).Encode(details); err != nil {
+		slog.ErrorContext(r.Context(), "Error during encoding", "error", err)
+	}
+}
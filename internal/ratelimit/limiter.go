@@ -0,0 +1,295 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGroup Route group whose limit applies to groups without their own
+const DefaultGroup = "default"
+
+// sweepInterval How often idle buckets and past quotas are dropped
+const sweepInterval = time.Minute
+
+// Rate A token bucket refilled with PerSecond tokens up to Burst, a zero PerSecond means unlimited
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Limit Requests allowed on a route group, per client IP and per principal, and per client per UTC day
+type Limit struct {
+	IP    Rate
+	Key   Rate
+	Daily int
+}
+
+// DefaultLimit Limit used when the default group has no limit of its own
+var DefaultLimit = Limit{IP: Rate{PerSecond: 10, Burst: 20}}
+
+// ParseLimit Parse a limit such as "ip=10/20 key=100/200 daily=50000", missing parts are unlimited
+func ParseLimit(value string) (Limit, error) {
+	var limit Limit
+	for _, field := range strings.Fields(value) {
+		name, setting, found := strings.Cut(field, "=")
+		if !found {
+			return Limit{}, fmt.Errorf("invalid rate limit %q", field)
+		}
+		var err error
+		switch name {
+		case "ip":
+			limit.IP, err = parseRate(setting)
+		case "key":
+			limit.Key, err = parseRate(setting)
+		case "daily":
+			limit.Daily, err = strconv.Atoi(setting)
+			if err == nil && limit.Daily < 0 {
+				err = fmt.Errorf("daily quota must not be negative")
+			}
+		default:
+			err = fmt.Errorf("unknown rate limit %q", name)
+		}
+		if err != nil {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: %v", field, err)
+		}
+	}
+	return limit, nil
+}
+
+// parseRate Parse a "perSecond/burst" rate, the burst defaults to the rate
+func parseRate(value string) (Rate, error) {
+	perSecond, burst, found := strings.Cut(value, "/")
+	rate, err := strconv.ParseFloat(perSecond, 64)
+	if err != nil || rate < 0 || math.IsInf(rate, 0) {
+		return Rate{}, fmt.Errorf("invalid rate %q", perSecond)
+	}
+	result := Rate{PerSecond: rate, Burst: int(math.Ceil(rate))}
+	if found {
+		if result.Burst, err = strconv.Atoi(burst); err != nil || result.Burst < 1 {
+			return Rate{}, fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	if rate > 0 && result.Burst < 1 {
+		result.Burst = 1
+	}
+	return result, nil
+}
+
+// ParseLimits Parse the limit of each route group, groups without their own use the DefaultGroup one, or DefaultLimit
+func ParseLimits(limits map[string]string) (map[string]Limit, error) {
+	parsed := map[string]Limit{DefaultGroup: DefaultLimit}
+	for group, value := range limits {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", group, err)
+		}
+		parsed[group] = limit
+	}
+	return parsed, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type quota struct {
+	day   string
+	count int
+}
+
+// Decision Outcome of a request, describing the most restrictive limit it is subject to
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// check One bucket or quota a request is subject to
+type check struct {
+	limit     int
+	remaining int
+	reset     time.Duration
+	// resetAfterConsume Reset once the request is counted
+	resetAfterConsume time.Duration
+	retryAfter        time.Duration
+	consume           func()
+}
+
+// Limiter Token buckets per client IP and per principal, and daily quotas per client, for each route group
+type Limiter struct {
+	mu        sync.Mutex
+	limits    map[string]Limit
+	buckets   map[string]*bucket
+	quotas    map[string]*quota
+	lastSweep time.Time
+}
+
+func NewLimiter(limits map[string]Limit) *Limiter {
+	return &Limiter{
+		limits:    limits,
+		buckets:   make(map[string]*bucket),
+		quotas:    make(map[string]*quota),
+		lastSweep: time.Now(),
+	}
+}
+
+// AllowIP Take a token from the bucket of the client IP on the route group, or none if it is exhausted. It is checked
+// before the request is authenticated, so requests with rejected credentials are throttled too
+func (l *Limiter) AllowIP(group string, ip string) Decision {
+	limit := l.limit(group)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var checks []check
+	if limit.IP.PerSecond > 0 {
+		checks = append(checks, l.bucketCheck(group+"|ip|"+ip, limit.IP, now))
+	}
+	return decide(checks)
+}
+
+// AllowClient Take a token from the bucket and the daily quota of the client on the route group, or none if any of them
+// is exhausted. key identifies the principal and is empty for unauthenticated requests, whose quota is counted by IP
+func (l *Limiter) AllowClient(group string, ip string, key string) Decision {
+	limit := l.limit(group)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var checks []check
+	if limit.Key.PerSecond > 0 && key != "" {
+		checks = append(checks, l.bucketCheck(group+"|key|"+key, limit.Key, now))
+	}
+	if limit.Daily > 0 {
+		client := "key|" + key
+		if key == "" {
+			client = "ip|" + ip
+		}
+		checks = append(checks, l.quotaCheck(group+"|"+client, limit.Daily, now))
+	}
+	return decide(checks)
+}
+
+func (l *Limiter) limit(group string) Limit {
+	limit, exists := l.limits[group]
+	if !exists {
+		limit = l.limits[DefaultGroup]
+	}
+	return limit
+}
+
+// now Get the current time, sweeping the idle buckets from time to time. The lock must be held
+func (l *Limiter) now() time.Time {
+	now := time.Now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	return now
+}
+
+// decide Consume every check, or none if any of them is exhausted, describing the most restrictive one
+func decide(checks []check) Decision {
+	if len(checks) == 0 {
+		return Decision{Allowed: true}
+	}
+
+	decision := Decision{Allowed: true, Remaining: math.MaxInt}
+	for _, c := range checks {
+		if c.retryAfter > 0 {
+			decision.Allowed = false
+			decision.RetryAfter = max(decision.RetryAfter, c.retryAfter)
+		}
+	}
+	for _, c := range checks {
+		if decision.Allowed {
+			c.consume()
+			c.remaining--
+			c.reset = c.resetAfterConsume
+		}
+		if c.remaining < decision.Remaining {
+			decision.Limit, decision.Remaining, decision.Reset = c.limit, c.remaining, c.reset
+		}
+	}
+	return decision
+}
+
+func (l *Limiter) bucketCheck(id string, rate Rate, now time.Time) check {
+	b, exists := l.buckets[id]
+	if !exists {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		l.buckets[id] = b
+	}
+	b.tokens = min(float64(rate.Burst), b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+
+	c := check{
+		limit:             rate.Burst,
+		remaining:         int(b.tokens),
+		reset:             secondsDuration((float64(rate.Burst) - b.tokens) / rate.PerSecond),
+		resetAfterConsume: secondsDuration((float64(rate.Burst) - b.tokens + 1) / rate.PerSecond),
+		consume:           func() { b.tokens-- },
+	}
+	if b.tokens < 1 {
+		c.retryAfter = secondsDuration((1 - b.tokens) / rate.PerSecond)
+	}
+	return c
+}
+
+func (l *Limiter) quotaCheck(id string, daily int, now time.Time) check {
+	day := now.UTC().Format(time.DateOnly)
+	q, exists := l.quotas[id]
+	if !exists || q.day != day {
+		q = &quota{day: day}
+		l.quotas[id] = q
+	}
+
+	untilTomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	c := check{
+		limit:             daily,
+		remaining:         daily - q.count,
+		reset:             untilTomorrow,
+		resetAfterConsume: untilTomorrow,
+		consume:           func() { q.count++ },
+	}
+	if q.count >= daily {
+		c.retryAfter = untilTomorrow
+	}
+	return c
+}
+
+// sweep Drop the buckets that refilled while idle and the quotas of past days, they are recreated as new on demand
+func (l *Limiter) sweep(now time.Time) {
+	for id, b := range l.buckets {
+		if now.Sub(b.last) > sweepInterval && l.isRefilled(id, b, now) {
+			delete(l.buckets, id)
+		}
+	}
+	day := now.UTC().Format(time.DateOnly)
+	for id, q := range l.quotas {
+		if q.day != day {
+			delete(l.quotas, id)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) isRefilled(id string, b *bucket, now time.Time) bool {
+	group, kind, _ := strings.Cut(id, "|")
+	limit := l.limit(group)
+	rate := limit.IP
+	if strings.HasPrefix(kind, "key|") {
+		rate = limit.Key
+	}
+	return rate.PerSecond == 0 || b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond >= float64(rate.Burst)
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
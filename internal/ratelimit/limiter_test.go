@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "", want: Limit{}},
+		{value: "ip=10/20 key=100/200 daily=50000", want: Limit{IP: Rate{PerSecond: 10, Burst: 20}, Key: Rate{PerSecond: 100, Burst: 200}, Daily: 50000}},
+		// The burst defaults to the rate, rounded up, and is at least 1
+		{value: "ip=2.5", want: Limit{IP: Rate{PerSecond: 2.5, Burst: 3}}},
+		{value: "ip=0.1", want: Limit{IP: Rate{PerSecond: 0.1, Burst: 1}}},
+		{value: "ip=0", want: Limit{}},
+		{value: "ip", wantErr: true},
+		{value: "ip=-1", wantErr: true},
+		{value: "ip=Inf", wantErr: true},
+		{value: "ip=10/0", wantErr: true},
+		{value: "daily=-1", wantErr: true},
+		{value: "hourly=10", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseLimit(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseLimit(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBucketRefill(t *testing.T) {
+	rate := Rate{PerSecond: 2, Burst: 4}
+	tests := []struct {
+		name string
+		// elapsed Time since the bucket was drained
+		elapsed       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "drained", elapsed: 0, wantRetry: 500 * time.Millisecond},
+		{name: "half a token", elapsed: 250 * time.Millisecond, wantRetry: 250 * time.Millisecond},
+		{name: "one token", elapsed: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{name: "two tokens and a half", elapsed: 1250 * time.Millisecond, wantAllowed: true, wantRemaining: 1},
+		{name: "refilled up to the burst", elapsed: time.Minute, wantAllowed: true, wantRemaining: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLimiter(nil)
+			start := time.Now()
+			for i := 0; i < rate.Burst; i++ {
+				if decision := decide([]check{l.bucketCheck("bucket", rate, start)}); !decision.Allowed {
+					t.Fatalf("request %d of the burst denied", i+1)
+				}
+			}
+
+			decision := decide([]check{l.bucketCheck("bucket", rate, start.Add(test.elapsed))})
+			if decision.Allowed != test.wantAllowed {
+				t.Fatalf("Allowed = %v, want %v", decision.Allowed, test.wantAllowed)
+			}
+			if decision.Allowed && decision.Remaining != test.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", decision.Remaining, test.wantRemaining)
+			}
+			if decision.RetryAfter != test.wantRetry {
+				t.Errorf("RetryAfter = %v, want %v", decision.RetryAfter, test.wantRetry)
+			}
+			if decision.Limit != rate.Burst {
+				t.Errorf("Limit = %d, want %d", decision.Limit, rate.Burst)
+			}
+		})
+	}
+}
+
+func TestAllowIP(t *testing.T) {
+	l := NewLimiter(map[string]Limit{
+		DefaultGroup: {IP: Rate{PerSecond: 0.001, Burst: 2}},
+		"unlimited":  {},
+	})
+	tests := []struct {
+		name  string
+		group string
+		ip    string
+		want  []bool
+	}{
+		{name: "burst then denied", group: DefaultGroup, ip: "192.0.2.1", want: []bool{true, true, false}},
+		{name: "each IP has its bucket", group: DefaultGroup, ip: "192.0.2.2", want: []bool{true, true, false}},
+		{name: "groups without a limit use the default one", group: "programs", ip: "192.0.2.1", want: []bool{true, true, false}},
+		{name: "group without limits", group: "unlimited", ip: "192.0.2.1", want: []bool{true, true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, want := range test.want {
+				if got := l.AllowIP(test.group, test.ip).Allowed; got != want {
+					t.Errorf("request %d Allowed = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowClient(t *testing.T) {
+	l := NewLimiter(map[string]Limit{DefaultGroup: {Key: Rate{PerSecond: 1000, Burst: 1000}, Daily: 2}})
+	tests := []struct {
+		name string
+		ip   string
+		key  string
+		want []bool
+	}{
+		{name: "daily quota of a principal", ip: "192.0.2.1", key: "api_key:reports", want: []bool{true, true, false}},
+		// The quota follows the principal, not its IP
+		{name: "same principal from another IP", ip: "192.0.2.2", key: "api_key:reports", want: []bool{false}},
+		{name: "unauthenticated requests counted by IP", ip: "192.0.2.1", want: []bool{true, true, false}},
+		{name: "another principal from the same IP", ip: "192.0.2.1", key: "jwt:alice", want: []bool{true, true, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, want := range test.want {
+				decision := l.AllowClient(DefaultGroup, test.ip, test.key)
+				if decision.Allowed != want {
+					t.Errorf("request %d Allowed = %v, want %v", i+1, decision.Allowed, want)
+				}
+				if !decision.Allowed && decision.RetryAfter <= 0 {
+					t.Errorf("request %d RetryAfter = %v, want until the next UTC day", i+1, decision.RetryAfter)
+				}
+			}
+		})
+	}
+}
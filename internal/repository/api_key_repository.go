@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	mssql "github.com/microsoft/go-mssqldb"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+	"strings"
+	"time"
+)
+
+// ApiKeyCredentials The hashes a presented secret is verified against. PreviousSecretHash is only set during a rotation grace period
+type ApiKeyCredentials struct {
+	Key                models.ApiKey
+	SecretHash         []byte
+	PreviousSecretHash []byte
+}
+
+const apiKeyQuery = `SELECT id, name, prefix, scopes, created_at, expires_at, revoked_at, rotated_at FROM api_keys`
+
+func scanApiKey(row rowScanner, extra ...any) (models.ApiKey, error) {
+	var apiKey models.ApiKey
+	var scopes string
+	dest := append([]any{&apiKey.Id, &apiKey.Name, &apiKey.Prefix, &scopes, &apiKey.CreatedAt, &apiKey.ExpiresAt,
+		&apiKey.RevokedAt, &apiKey.RotatedAt}, extra...)
+	err := row.Scan(dest...)
+	apiKey.Scopes = strings.Split(scopes, ",")
+	return apiKey, err
+}
+
+// AddApiKey Store a new API key, only the hash of its secret is kept
+func AddApiKey(ctx context.Context, apiKey *models.ApiKey, secretHash []byte, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddApiKey", func(ctx context.Context) (_ uint, err error) {
+		query := `INSERT INTO api_keys (name, prefix, secret_hash, scopes, expires_at)
+				VALUES (@p1, @p2, @p3, @p4, @p5);
+				SELECT SCOPE_IDENTITY() AS id`
+
+		row := db.QueryRowContext(ctx, query,
+			sql.Named("p1", apiKey.Name),
+			sql.Named("p2", apiKey.Prefix),
+			sql.Named("p3", secretHash),
+			sql.Named("p4", strings.Join(apiKey.Scopes, ",")),
+			sql.Named("p5", apiKey.ExpiresAt),
+		)
+
+		var id uint
+		if err := row.Scan(&id); err != nil {
+			if isDuplicateKey(err) {
+				return 0, apperrors.Conflict("api_key_exists", "An API key with this name already exists")
+			}
+			return 0, fmt.Errorf("error while creating the api key: %w", err)
+		}
+		slog.InfoContext(ctx, "Added api key", "name", apiKey.Name, "id", id)
+		return id, nil
+	})
+}
+
+// isDuplicateKey Report whether err is the violation of a UNIQUE constraint (2627) or index (2601)
+func isDuplicateKey(err error) bool {
+	var sqlErr mssql.Error
+	return errors.As(err, &sqlErr) && (sqlErr.Number == 2627 || sqlErr.Number == 2601)
+}
+
+// GetApiKeyByID Get an API key by its ID
+func GetApiKeyByID(ctx context.Context, apiKeyID uint, db *sql.DB) (*models.ApiKey, error) {
+	return runQuery(ctx, "GetApiKeyByID", func(ctx context.Context) (_ *models.ApiKey, err error) {
+		query := apiKeyQuery + ` WHERE id = @p1;`
+		row := db.QueryRowContext(ctx, query, sql.Named("p1", apiKeyID))
+		apiKey, err := scanApiKey(row)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, apperrors.NotFound("api_key_not_found", "Api key not found")
+			}
+			return nil, err
+		}
+		return &apiKey, nil
+	})
+}
+
+// GetAllApiKeys Get all API keys, revoked and expired ones included
+func GetAllApiKeys(ctx context.Context, db *sql.DB) ([]models.ApiKey, error) {
+	return runQuery(ctx, "GetAllApiKeys", func(ctx context.Context) (_ []models.ApiKey, err error) {
+		query := apiKeyQuery + ` ORDER BY created_at;`
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error closing rows", "error", err)
+			}
+		}(rows)
+
+		var apiKeys []models.ApiKey
+		for rows.Next() {
+			apiKey, err := scanApiKey(rows)
+			if err != nil {
+				return nil, err
+			}
+			apiKeys = append(apiKeys, apiKey)
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return apiKeys, nil
+	})
+}
+
+// GetApiKeyCredentials Get the credentials of a usable API key by its prefix, nil if it is unknown, revoked or expired
+func GetApiKeyCredentials(ctx context.Context, prefix string, db *sql.DB) (*ApiKeyCredentials, error) {
+	return runQuery(ctx, "GetApiKeyCredentials", func(ctx context.Context) (_ *ApiKeyCredentials, err error) {
+		query := `SELECT id, name, prefix, scopes, created_at, expires_at, revoked_at, rotated_at, secret_hash,
+				CASE WHEN previous_expires_at > GETUTCDATE() THEN previous_secret_hash END
+				FROM api_keys
+				WHERE prefix = @p1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > GETUTCDATE());`
+		row := db.QueryRowContext(ctx, query, sql.Named("p1", prefix))
+
+		var credentials ApiKeyCredentials
+		apiKey, err := scanApiKey(row, &credentials.SecretHash, &credentials.PreviousSecretHash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		credentials.Key = apiKey
+		return &credentials, nil
+	})
+}
+
+// RotateApiKey Replace the secret of an API key. The previous secret stays valid for the grace period
+func RotateApiKey(ctx context.Context, apiKeyID uint, secretHash []byte, grace time.Duration, db *sql.DB) error {
+	return runExec(ctx, "RotateApiKey", func(ctx context.Context) (err error) {
+		query := `UPDATE api_keys SET previous_secret_hash = secret_hash,
+				previous_expires_at = DATEADD(SECOND, @grace, GETUTCDATE()),
+				secret_hash = @secret_hash, rotated_at = GETUTCDATE()
+				WHERE id = @id AND revoked_at IS NULL;`
+		result, err := db.ExecContext(ctx, query,
+			sql.Named("grace", int(grace.Seconds())),
+			sql.Named("secret_hash", secretHash),
+			sql.Named("id", apiKeyID),
+		)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return apperrors.NotFound("api_key_not_found", "Api key not found or revoked")
+		}
+
+		slog.InfoContext(ctx, "Rotated api key", "id", apiKeyID)
+		return nil
+	})
+}
+
+// RevokeApiKey Revoke an API key, it is kept for auditing but can no longer be used
+func RevokeApiKey(ctx context.Context, apiKeyID uint, db *sql.DB) error {
+	return runExec(ctx, "RevokeApiKey", func(ctx context.Context) (err error) {
+		query := `UPDATE api_keys SET revoked_at = GETUTCDATE(), previous_secret_hash = NULL, previous_expires_at = NULL
+				WHERE id = @p1 AND revoked_at IS NULL;`
+		result, err := db.ExecContext(ctx, query, sql.Named("p1", apiKeyID))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return apperrors.NotFound("api_key_not_found", "Api key not found or revoked")
+		}
+
+		slog.InfoContext(ctx, "Revoked api key", "id", apiKeyID)
+		return nil
+	})
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+)
+
+const changeRequestQuery = `SELECT id, action, schedule_id, payload, comment, status, submitted_by, submitted_at,
+			reviewed_by, reviewed_at, review_comment FROM change_requests`
+
+func scanChangeRequest(row rowScanner) (models.ChangeRequest, error) {
+	var changeRequest models.ChangeRequest
+	var payload sql.NullString
+	err := row.Scan(&changeRequest.Id, &changeRequest.Action, &changeRequest.ScheduleId, &payload, &changeRequest.Comment,
+		&changeRequest.Status, &changeRequest.SubmittedBy, &changeRequest.SubmittedAt,
+		&changeRequest.ReviewedBy, &changeRequest.ReviewedAt, &changeRequest.ReviewComment)
+	if err != nil {
+		return changeRequest, err
+	}
+	if payload.Valid {
+		changeRequest.Schedule = &models.Schedule{}
+		if err = json.Unmarshal([]byte(payload.String), changeRequest.Schedule); err != nil {
+			return changeRequest, fmt.Errorf("invalid change request payload: %w", err)
+		}
+	}
+	return changeRequest, nil
+}
+
+// AddChangeRequest Submit a schedule change for review
+func AddChangeRequest(ctx context.Context, changeRequest *models.ChangeRequest, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddChangeRequest", func(ctx context.Context) (_ uint, err error) {
+		var payload *string
+		if changeRequest.Schedule != nil {
+			data, err := json.Marshal(changeRequest.Schedule)
+			if err != nil {
+				return 0, fmt.Errorf("error while encoding the change request payload: %w", err)
+			}
+			encoded := string(data)
+			payload = &encoded
+		}
+
+		query := `INSERT INTO change_requests (action, schedule_id, payload, comment, status, submitted_by)
+				VALUES (@p1, @p2, @p3, @p4, @p5, @p6);
+				SELECT SCOPE_IDENTITY() AS id`
+
+		row := db.QueryRowContext(ctx, query,
+			sql.Named("p1", changeRequest.Action),
+			sql.Named("p2", changeRequest.ScheduleId),
+			sql.Named("p3", payload),
+			sql.Named("p4", changeRequest.Comment),
+			sql.Named("p5", models.ChangeStatusPending),
+			sql.Named("p6", changeRequest.SubmittedBy),
+		)
+
+		var id uint
+		if err := row.Scan(&id); err != nil {
+			return 0, fmt.Errorf("error while creating the change request: %w", err)
+		}
+		slog.InfoContext(ctx, "Added change request", "id", id)
+		return id, nil
+	})
+}
+
+// GetChangeRequestByID Get a change request by its ID
+func GetChangeRequestByID(ctx context.Context, changeRequestID uint, db *sql.DB) (*models.ChangeRequest, error) {
+	return runQuery(ctx, "GetChangeRequestByID", func(ctx context.Context) (_ *models.ChangeRequest, err error) {
+		query := changeRequestQuery + ` WHERE id = @p1;`
+		row := db.QueryRowContext(ctx, query, sql.Named("p1", changeRequestID))
+		changeRequest, err := scanChangeRequest(row)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, apperrors.NotFound("change_request_not_found", "Change request not found")
+			}
+			return nil, err
+		}
+		return &changeRequest, nil
+	})
+}
+
+// GetChangeRequests Get the change requests history, optionally only the ones in a status
+func GetChangeRequests(ctx context.Context, status string, db *sql.DB) ([]models.ChangeRequest, error) {
+	return runQuery(ctx, "GetChangeRequests", func(ctx context.Context) (_ []models.ChangeRequest, err error) {
+		query := changeRequestQuery + ` WHERE @p1 = '' OR status = @p1 ORDER BY submitted_at DESC;`
+		rows, err := db.QueryContext(ctx, query, sql.Named("p1", status))
+		if err != nil {
+			return nil, err
+		}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error closing rows", "error", err)
+			}
+		}(rows)
+
+		var changeRequests []models.ChangeRequest
+		for rows.Next() {
+			changeRequest, err := scanChangeRequest(rows)
+			if err != nil {
+				return nil, err
+			}
+			changeRequests = append(changeRequests, changeRequest)
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return changeRequests, nil
+	})
+}
+
+// reviewChangeRequest Move a pending change request to a reviewed status, failing if it was already reviewed
+func reviewChangeRequest(ctx context.Context, changeRequestID uint, status string, review models.ChangeReview, q querier) error {
+	query := `UPDATE change_requests SET status = @status, reviewed_by = @reviewed_by, reviewed_at = GETUTCDATE(), review_comment = @comment
+			WHERE id = @id AND status = @pending;`
+	result, err := q.ExecContext(ctx, query,
+		sql.Named("status", status),
+		sql.Named("reviewed_by", review.ReviewedBy),
+		sql.Named("comment", review.Comment),
+		sql.Named("id", changeRequestID),
+		sql.Named("pending", models.ChangeStatusPending),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperrors.Conflict("change_request_already_reviewed", "Change request already reviewed")
+	}
+	return nil
+}
+
+// RejectChangeRequest Reject a pending change request, leaving the schedules untouched
+func RejectChangeRequest(ctx context.Context, changeRequestID uint, review models.ChangeReview, db *sql.DB) error {
+	return runExec(ctx, "RejectChangeRequest", func(ctx context.Context) (err error) {
+		if err := reviewChangeRequest(ctx, changeRequestID, models.ChangeStatusRejected, review, db); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Rejected change request", "id", changeRequestID)
+		return nil
+	})
+}
+
+// ApproveChangeRequest Approve a pending change request and apply it to the schedules, in one transaction, so the change
+// request stays pending when applying it fails
+func ApproveChangeRequest(ctx context.Context, changeRequestID uint, review models.ChangeReview, db *sql.DB) error {
+	return runExec(ctx, "ApproveChangeRequest", func(ctx context.Context) (err error) {
+		changeRequest, err := GetChangeRequestByID(ctx, changeRequestID, db)
+		if err != nil {
+			return err
+		}
+		if changeRequest.Status != models.ChangeStatusPending {
+			return apperrors.Conflict("change_request_already_reviewed", "Change request already reviewed")
+		}
+		if changeRequest.Schedule != nil && changeRequest.Action != models.ChangeActionDelete {
+			if err = checkScheduleProgram(ctx, changeRequest.Schedule.ProgramId, db); err != nil {
+				return notApplicable(err)
+			}
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		// Claiming the change request first prevents two managers from applying it twice
+		if err = reviewChangeRequest(ctx, changeRequestID, models.ChangeStatusApproved, review, tx); err != nil {
+			return err
+		}
+		if err = applyChangeRequest(ctx, changeRequest, tx); err != nil {
+			return notApplicable(err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		slog.InfoContext(ctx, "Approved change request", "id", changeRequestID)
+		return nil
+	})
+}
+
+// notApplicable Get the error of a change request that cannot be applied because the schedules changed since it was
+// submitted, e.g. its schedule was deleted. Other errors are returned as they are
+func notApplicable(err error) error {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) && !errors.Is(err, apperrors.ErrUnavailable) {
+		reason := appErr.Message
+		for _, field := range appErr.Fields {
+			reason = field.Message
+		}
+		return apperrors.Conflict("change_request_not_applicable", "The change request cannot be applied: "+reason)
+	}
+	return fmt.Errorf("error while applying the change request: %w", err)
+}
+
+// applyChangeRequest Apply an approved change request in the transaction claiming it, its program already checked
+func applyChangeRequest(ctx context.Context, changeRequest *models.ChangeRequest, tx *sql.Tx) error {
+	switch changeRequest.Action {
+	case models.ChangeActionAdd:
+		id, err := addSchedule(ctx, changeRequest.Schedule, tx)
+		if err != nil {
+			return err
+		}
+		// Keep track of the schedule created by the change request
+		_, err = tx.ExecContext(ctx, `UPDATE change_requests SET schedule_id = @schedule_id WHERE id = @id;`,
+			sql.Named("schedule_id", id),
+			sql.Named("id", *changeRequest.Id),
+		)
+		return err
+	case models.ChangeActionUpdate:
+		// Change requests edit the lineup fields, never the window of an override
+		schedule := *changeRequest.Schedule
+		schedule.IsOverride = false
+		_, err := updateSchedule(ctx, *changeRequest.ScheduleId, schedule, 0, tx)
+		return err
+	case models.ChangeActionDelete:
+		return deleteSchedule(ctx, *changeRequest.ScheduleId, 0, tx)
+	}
+	return fmt.Errorf("unknown change request action %q", changeRequest.Action)
+}
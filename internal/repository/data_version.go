@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Tables whose data version can be queried
+const (
+	TablePrograms             = "programs"
+	TableSchedules            = "schedules"
+	TableHolidays             = "holidays"
+	TableHolidaySubstitutions = "holiday_substitutions"
+	TableChangeRequests       = "change_requests"
+)
+
+// DataVersion Version of the rows of some tables, read from the data_versions table their triggers bump with every
+// insert, update and delete. Modified is when the latest of them was written, to the second, always later than the
+// Modified of the previous version
+type DataVersion struct {
+	Tag      string
+	Modified time.Time
+}
+
+// GetDataVersion Get the version of the rows of tables, cheaper to query than the rows themselves. It is to be queried
+// before the rows, so a write committed in between makes the rows newer than the version, never older
+func GetDataVersion(ctx context.Context, tables []string, db *sql.DB) (DataVersion, error) {
+	return runQuery(ctx, "GetDataVersion", func(ctx context.Context) (_ DataVersion, err error) {
+		placeholders := make([]string, len(tables))
+		args := make([]any, len(tables))
+		for i, table := range tables {
+			placeholders[i] = fmt.Sprintf("@t%d", i)
+			args[i] = sql.Named(fmt.Sprintf("t%d", i), table)
+		}
+		query := `SELECT table_name, CAST(version AS BIGINT), modified FROM data_versions
+				WHERE table_name IN (` + strings.Join(placeholders, ", ") + `) ORDER BY table_name;`
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return DataVersion{}, err
+		}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error closing rows", "error", err)
+			}
+		}(rows)
+
+		hash := sha256.New()
+		var version DataVersion
+		found := 0
+		for rows.Next() {
+			var table string
+			var rowVersion int64
+			var modified time.Time
+			if err = rows.Scan(&table, &rowVersion, &modified); err != nil {
+				return DataVersion{}, err
+			}
+			fmt.Fprintf(hash, "%s:%d.", table, rowVersion)
+			if modified.After(version.Modified) {
+				version.Modified = modified
+			}
+			found++
+		}
+		if err = rows.Err(); err != nil {
+			return DataVersion{}, err
+		}
+		if found != len(tables) {
+			return DataVersion{}, fmt.Errorf("data versions of %s not found", strings.Join(tables, ", "))
+		}
+
+		version.Tag = hex.EncodeToString(hash.Sum(nil)[:8])
+		version.Modified = version.Modified.UTC()
+		return version, nil
+	})
+}
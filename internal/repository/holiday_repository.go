@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+	"time"
+)
+
+const holidayQuery = `SELECT id, name, date, country, region, recurring, lineup_day FROM holidays`
+
+func scanHoliday(row rowScanner) (models.Holiday, error) {
+	var holiday models.Holiday
+	var date time.Time
+	err := row.Scan(&holiday.Id, &holiday.Name, &date, &holiday.Country, &holiday.Region, &holiday.Recurring, &holiday.LineupDay)
+	holiday.Date = date.Format("2006-01-02")
+	return holiday, err
+}
+
+// getHolidaySubstitutions Get the program substitutions of a holiday
+func getHolidaySubstitutions(ctx context.Context, holidayID uint, db *sql.DB) ([]models.HolidaySubstitution, error) {
+	query := `SELECT id, from_program_id, to_program_id FROM holiday_substitutions WHERE holiday_id = @p1;`
+	rows, err := db.QueryContext(ctx, query, sql.Named("p1", holidayID))
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "Error closing rows", "error", err)
+		}
+	}(rows)
+
+	substitutions := []models.HolidaySubstitution{}
+	for rows.Next() {
+		var substitution models.HolidaySubstitution
+		err = rows.Scan(&substitution.Id, &substitution.FromProgramId, &substitution.ToProgramId)
+		if err != nil {
+			return nil, err
+		}
+		substitutions = append(substitutions, substitution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return substitutions, nil
+}
+
+// AddHoliday Create a holiday along with its program substitutions
+func AddHoliday(ctx context.Context, holiday *models.Holiday, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddHoliday", func(ctx context.Context) (_ uint, err error) {
+		for i, substitution := range holiday.Substitutions {
+			if _, err = checkProgramReference(ctx, fmt.Sprintf("substitutions[%d].from_program_id", i), substitution.FromProgramId, db); err != nil {
+				return 0, err
+			}
+			if _, err = checkProgramReference(ctx, fmt.Sprintf("substitutions[%d].to_program_id", i), substitution.ToProgramId, db); err != nil {
+				return 0, err
+			}
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+
+		query := `INSERT INTO holidays (name, date, country, region, recurring, lineup_day)
+				VALUES (@p1, @p2, @p3, @p4, @p5, @p6);
+				SELECT SCOPE_IDENTITY() AS id`
+
+		row := tx.QueryRowContext(ctx, query,
+			sql.Named("p1", holiday.Name),
+			sql.Named("p2", holiday.Date),
+			sql.Named("p3", holiday.Country),
+			sql.Named("p4", holiday.Region),
+			sql.Named("p5", holiday.Recurring),
+			sql.Named("p6", holiday.LineupDay),
+		)
+
+		var id uint
+		if err = row.Scan(&id); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("error while creating the holiday: %w", err)
+		}
+
+		for _, substitution := range holiday.Substitutions {
+			_, err = tx.ExecContext(ctx, `INSERT INTO holiday_substitutions (holiday_id, from_program_id, to_program_id) VALUES (@p1, @p2, @p3);`,
+				sql.Named("p1", id),
+				sql.Named("p2", substitution.FromProgramId),
+				sql.Named("p3", substitution.ToProgramId),
+			)
+			if err != nil {
+				tx.Rollback()
+				return 0, fmt.Errorf("error while creating the holiday substitutions: %w", err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		slog.InfoContext(ctx, "Added holiday", "id", id)
+		return id, nil
+	})
+}
+
+// GetHolidayByID Get a holiday by its ID
+func GetHolidayByID(ctx context.Context, holidayID uint, db *sql.DB) (*models.Holiday, error) {
+	return runQuery(ctx, "GetHolidayByID", func(ctx context.Context) (_ *models.Holiday, err error) {
+		query := holidayQuery + ` WHERE id = @p1;`
+		row := db.QueryRowContext(ctx, query, sql.Named("p1", holidayID))
+		holiday, err := scanHoliday(row)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, apperrors.NotFound("holiday_not_found", "Holiday not found")
+			}
+			return nil, err
+		}
+
+		holiday.Substitutions, err = getHolidaySubstitutions(ctx, *holiday.Id, db)
+		if err != nil {
+			return nil, err
+		}
+		return &holiday, nil
+	})
+}
+
+// GetAllHolidays Get all holidays, optionally only the ones of a country
+func GetAllHolidays(ctx context.Context, country string, db *sql.DB) ([]models.Holiday, error) {
+	return runQuery(ctx, "GetAllHolidays", func(ctx context.Context) (_ []models.Holiday, err error) {
+		query := holidayQuery + ` WHERE @p1 = '' OR country = @p1 ORDER BY date;`
+		rows, err := db.QueryContext(ctx, query, sql.Named("p1", country))
+		if err != nil {
+			return nil, err
+		}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error closing rows", "error", err)
+			}
+		}(rows)
+
+		var holidays []models.Holiday
+		for rows.Next() {
+			holiday, err := scanHoliday(rows)
+			if err != nil {
+				return nil, err
+			}
+			holidays = append(holidays, holiday)
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for i := range holidays {
+			holidays[i].Substitutions, err = getHolidaySubstitutions(ctx, *holidays[i].Id, db)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return holidays, nil
+	})
+}
+
+// GetHolidayForDate Get the holiday falling on a date in a country and region, nil if the date is a regular day.
+// Region specific and non-recurring holidays take precedence
+func GetHolidayForDate(ctx context.Context, date time.Time, country string, region string, db *sql.DB) (*models.Holiday, error) {
+	return runQuery(ctx, "GetHolidayForDate", func(ctx context.Context) (_ *models.Holiday, err error) {
+		query := `SELECT TOP 1 id, name, date, country, region, recurring, lineup_day FROM holidays
+				WHERE country = @p1 AND (region IS NULL OR region = @p2)
+				AND (date = @p3 OR (recurring = 1 AND MONTH(date) = @p4 AND DAY(date) = @p5))
+				ORDER BY CASE WHEN region IS NULL THEN 1 ELSE 0 END, recurring;`
+		row := db.QueryRowContext(ctx, query,
+			sql.Named("p1", country),
+			sql.Named("p2", region),
+			sql.Named("p3", date.Format("2006-01-02")),
+			sql.Named("p4", int(date.Month())),
+			sql.Named("p5", date.Day()),
+		)
+		holiday, err := scanHoliday(row)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		holiday.Substitutions, err = getHolidaySubstitutions(ctx, *holiday.Id, db)
+		if err != nil {
+			return nil, err
+		}
+		return &holiday, nil
+	})
+}
+
+// DeleteHoliday Delete a holiday and its program substitutions
+func DeleteHoliday(ctx context.Context, holidayID uint, db *sql.DB) error {
+	return runExec(ctx, "DeleteHoliday", func(ctx context.Context) (err error) {
+		query := `DELETE FROM holidays WHERE id = @p1;`
+		_, err = db.ExecContext(ctx, query, sql.Named("p1", holidayID))
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Deleted holiday", "id", holidayID)
+		return nil
+	})
+}
+
+// applyHoliday Mark the schedules airing on a holiday and swap the substituted programs
+func applyHoliday(holiday *models.Holiday, schedules []models.Schedule) {
+	for i := range schedules {
+		schedules[i].Holiday = &holiday.Name
+		for _, substitution := range holiday.Substitutions {
+			if schedules[i].ProgramId == substitution.FromProgramId {
+				substitutedFor := schedules[i].ProgramId
+				schedules[i].ProgramId = substitution.ToProgramId
+				schedules[i].SubstitutedFor = &substitutedFor
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"errors"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/metrics"
+	"time"
+)
+
+// observeQuery Record the duration of a repository function and whether it failed, deferred with its named error.
+// Errors reporting the outcome of the request, such as a missing row or a stale version, are not failures
+func observeQuery(function string, start time.Time, err *error) {
+	metrics.DBQueryDuration.Observe(time.Since(start).Seconds(), function)
+	if *err != nil && !isOutcome(*err) {
+		metrics.DBQueryErrors.Inc(function)
+	}
+}
+
+// isOutcome Report whether err tells the client about its request rather than a failure of the database
+func isOutcome(err error) bool {
+	return errors.Is(err, apperrors.ErrNotFound) || errors.Is(err, apperrors.ErrValidation) ||
+		errors.Is(err, apperrors.ErrConflict) || errors.Is(err, apperrors.ErrPreconditionFailed)
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+)
+
+// column A column updatable by a patch, with its value in the current and the patched row
+type column struct {
+	name    string
+	current any
+	patched any
+}
+
+// columnValue Get the value a column is stored with, so equal values are told apart from changed ones
+func columnValue(value any) any {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		value = v.Elem().Interface()
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		stored, err := valuer.Value()
+		if err == nil {
+			return stored
+		}
+	}
+	return value
+}
+
+// Patched Columns changed by a patch, and the version of the row after it
+type Patched struct {
+	Changed []string
+	Version uint64
+}
+
+// patchRow Update the columns of a row whose value changed, and the embargo along with publish_at, if the row is still
+// at version. Nothing is run when no column changed, sql.ErrNoRows is returned when no row matched
+func patchRow(ctx context.Context, table string, id uint, version uint64, columns []column, q querier) (Patched, error) {
+	result := Patched{Changed: []string{}, Version: version}
+	var assignments []string
+	args := []any{sql.Named("id", id), versionArg(version)}
+	for _, c := range columns {
+		value := columnValue(c.patched)
+		if reflect.DeepEqual(columnValue(c.current), value) {
+			continue
+		}
+		result.Changed = append(result.Changed, c.name)
+		assignments = append(assignments, c.name+" = @"+c.name)
+		args = append(args, sql.Named(c.name, value))
+		if c.name == "publish_at" {
+			assignments = append(assignments, "embargoed = CASE WHEN @publish_at > GETUTCDATE() THEN 1 ELSE 0 END")
+		}
+	}
+	if len(result.Changed) == 0 {
+		return result, nil
+	}
+
+	query := returningVersion(`UPDATE ` + table + ` SET ` + strings.Join(assignments, ", ") +
+		` ` + versionOutput + ` WHERE id = @id AND ` + versionFilter + `;`)
+	if err := q.QueryRowContext(ctx, query, args...).Scan(&result.Version); err != nil {
+		return Patched{}, err
+	}
+	return result, nil
+}
@@ -1,158 +1,238 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
 	"openprogramschedule/internal/models"
 )
 
-// AddProgram Create new program
-func AddProgram(program *models.Program, db *sql.DB) (uint, error) {
-	query := `INSERT INTO programs (name, description, host, category, in_production)
-             VALUES (@p1, @p2, @p3, @p4, @p5);
-             SELECT SCOPE_IDENTITY() AS id`
-
-	row := db.QueryRow(query, sql.Named("p1", program.Name),
-		sql.Named("p2", program.Description),
-		sql.Named("p3", program.Host),
-		sql.Named("p4", program.Category),
-		sql.Named("p5", program.InProduction))
-
-	var id uint
-	err := row.Scan(&id)
-	if err != nil {
-		return 0, fmt.Errorf("error while creating the program: %v", err)
-	}
-
-	fmt.Printf("Added new program: %+v\n", program.Name)
-	return id, nil
-}
+// programQuery Select every program column
+const programQuery = `SELECT id, name, description, host, category, in_production, publish_at, CAST(row_version AS BIGINT) FROM programs`
 
-// GetProgramByID Get Program by id
-func GetProgramByID(programID uint, db *sql.DB) (*models.Program, error) {
-	query := `SELECT * FROM programs WHERE id = @p1;`
-	row := db.QueryRow(query, sql.Named("p1", programID))
-	var program models.Program
-	err := row.Scan(&program.Id, &program.Name, &program.Description, &program.Host, &program.Category, &program.InProduction)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &program, errors.New("program not found")
-		}
-		return &program, err
-	}
+// programVisibleFilter Hide the embargoed programs when @public is set
+const programVisibleFilter = `(@public = 0 OR embargoed = 0)`
 
-	return &program, nil
+func scanProgram(row rowScanner) (models.Program, error) {
+	var program models.Program
+	err := row.Scan(&program.Id, &program.Name, &program.Description, &program.Host, &program.Category, &program.InProduction, &program.PublishAt, &program.Version)
+	return program, err
 }
 
-// GetProgramByName Get Program by name
-func GetProgramByName(programName string, db *sql.DB) (*models.Program, error) {
-	query := `SELECT * FROM programs WHERE name = @p1;`
-	row := db.QueryRow(query, sql.Named("p1", programName))
-	var program models.Program
-	err := row.Scan(&program.Id, &program.Name, &program.Description, &program.Host, &program.Category, &program.InProduction)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &program, errors.New("program not found")
+// AddProgram Create new program
+func AddProgram(ctx context.Context, program *models.Program, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddProgram", func(ctx context.Context) (_ uint, err error) {
+		query := `INSERT INTO programs (name, description, host, category, in_production, publish_at, embargoed)
+	             VALUES (@p1, @p2, @p3, @p4, @p5, @p6, CASE WHEN @p6 > GETUTCDATE() THEN 1 ELSE 0 END);
+	             SELECT SCOPE_IDENTITY() AS id`
+
+		row := db.QueryRowContext(ctx, query, sql.Named("p1", program.Name),
+			sql.Named("p2", program.Description),
+			sql.Named("p3", program.Host),
+			sql.Named("p4", program.Category),
+			sql.Named("p5", program.InProduction),
+			sql.Named("p6", program.PublishAt))
+
+		var id uint
+		err = row.Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("error while creating the program: %w", err)
 		}
-		return &program, err
-	}
 
-	return &program, nil
+		slog.InfoContext(ctx, "Added new program", "name", program.Name)
+		return id, nil
+	})
 }
 
-// GetProgramsByCategory Get programs by category
-func GetProgramsByCategory(category string, db *sql.DB) ([]models.Program, error) {
-	query := `SELECT * FROM programs WHERE category = @p1;`
-	rows, err := db.Query(query, sql.Named("p1", category))
-	if err != nil {
-		return nil, err
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Printf("Error closing rows: %v", err)
-		}
-	}(rows)
+// GetProgramByID Get Program by id, only if not embargoed when publicOnly is set
+func GetProgramByID(ctx context.Context, programID uint, publicOnly bool, db *sql.DB) (*models.Program, error) {
+	return cachedRead(ctx, programCache, fmt.Sprint("id:", programID), publicOnly, func() (*models.Program, error) {
+		return runQuery(ctx, "GetProgramByID", func(ctx context.Context) (_ *models.Program, err error) {
+			query := programQuery + ` WHERE id = @p1 AND ` + programVisibleFilter + `;`
+			row := db.QueryRowContext(ctx, query, sql.Named("p1", programID), sql.Named("public", publicOnly))
+			program, err := scanProgram(row)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return &program, apperrors.NotFound("program_not_found", "Program not found")
+				}
+				return &program, err
+			}
+
+			return &program, nil
+		})
+	})
+}
 
-	var programs []models.Program
-	for rows.Next() {
-		var program models.Program
-		err = rows.Scan(&program.Id, &program.Name, &program.Description, &program.Host, &program.Category, &program.InProduction)
-		if err != nil {
-			return nil, err
-		}
-		programs = append(programs, program)
-	}
+// GetProgramByName Get Program by name, only if not embargoed when publicOnly is set
+func GetProgramByName(ctx context.Context, programName string, publicOnly bool, db *sql.DB) (*models.Program, error) {
+	return cachedRead(ctx, programCache, "name:"+programName, publicOnly, func() (*models.Program, error) {
+		return runQuery(ctx, "GetProgramByName", func(ctx context.Context) (_ *models.Program, err error) {
+			query := programQuery + ` WHERE name = @p1 AND ` + programVisibleFilter + `;`
+			row := db.QueryRowContext(ctx, query, sql.Named("p1", programName), sql.Named("public", publicOnly))
+			program, err := scanProgram(row)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return &program, apperrors.NotFound("program_not_found", "Program not found")
+				}
+				return &program, err
+			}
+
+			return &program, nil
+		})
+	})
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+// GetProgramsByCategory Get programs by category, only the ones not embargoed if publicOnly is set
+func GetProgramsByCategory(ctx context.Context, category string, publicOnly bool, db *sql.DB) ([]models.Program, error) {
+	return cachedRead(ctx, programCache, "category:"+category, publicOnly, func() ([]models.Program, error) {
+		return runQuery(ctx, "GetProgramsByCategory", func(ctx context.Context) (_ []models.Program, err error) {
+			query := programQuery + ` WHERE category = @p1 AND ` + programVisibleFilter + `;`
+			rows, err := db.QueryContext(ctx, query, sql.Named("p1", category), sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer func(rows *sql.Rows) {
+				err := rows.Close()
+				if err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}(rows)
+
+			var programs []models.Program
+			for rows.Next() {
+				program, err := scanProgram(rows)
+				if err != nil {
+					return nil, err
+				}
+				programs = append(programs, program)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+
+			return programs, nil
+		})
+	})
+}
 
-	return programs, nil
+// GetAllPrograms Get all programs, only the ones not embargoed if publicOnly is set
+func GetAllPrograms(ctx context.Context, publicOnly bool, db *sql.DB) ([]models.Program, error) {
+	return cachedRead(ctx, programCache, "all", publicOnly, func() ([]models.Program, error) {
+		return runQuery(ctx, "GetAllPrograms", func(ctx context.Context) (_ []models.Program, err error) {
+			query := programQuery + ` WHERE ` + programVisibleFilter + `;`
+			rows, err := db.QueryContext(ctx, query, sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer func(rows *sql.Rows) {
+				err := rows.Close()
+				if err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}(rows)
+
+			var programs []models.Program
+			for rows.Next() {
+				program, err := scanProgram(rows)
+				if err != nil {
+					return nil, err
+				}
+				programs = append(programs, program)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+
+			return programs, nil
+		})
+	})
 }
 
-// GetAllPrograms Get all programs
-func GetAllPrograms(db *sql.DB) ([]models.Program, error) {
-	query := `SELECT * FROM programs;`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Printf("Error closing rows: %v", err)
+// UpdateProgramByID Update program by id if its version is still version, any when 0, returning the new version
+func UpdateProgramByID(ctx context.Context, programID uint, updatedProgram models.Program, version uint64, db *sql.DB) (uint64, error) {
+	return runQuery(withVersion(ctx, version), "UpdateProgramByID", func(ctx context.Context) (_ uint64, err error) {
+		query := returningVersion(`UPDATE programs SET name = @name, description = @description, host = @host, category = @category, in_production = @in_production,
+	             publish_at = @publish_at, embargoed = CASE WHEN @publish_at > GETUTCDATE() THEN 1 ELSE 0 END
+	             ` + versionOutput + ` WHERE id = @id AND ` + versionFilter + `;`)
+
+		var newVersion uint64
+		err = db.QueryRowContext(ctx, query,
+			sql.Named("name", updatedProgram.Name),
+			sql.Named("description", updatedProgram.Description),
+			sql.Named("host", updatedProgram.Host),
+			sql.Named("category", updatedProgram.Category),
+			sql.Named("in_production", updatedProgram.InProduction),
+			sql.Named("publish_at", updatedProgram.PublishAt),
+			sql.Named("id", programID),
+			versionArg(version),
+		).Scan(&newVersion)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, missingRow(ctx, "programs", programID, apperrors.NotFound("program_not_found", "Program not found"), db)
 		}
-	}(rows)
-
-	var programs []models.Program
-	for rows.Next() {
-		var program models.Program
-		err = rows.Scan(&program.Id, &program.Name, &program.Description, &program.Host, &program.Category, &program.InProduction)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		programs = append(programs, program)
-	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+		slog.InfoContext(ctx, "Program updated", "id", programID, "name", updatedProgram.Name)
 
-	return programs, nil
+		return newVersion, nil
+	})
 }
 
-// UpdateProgramByID Update program by id
-func UpdateProgramByID(programID uint, updatedProgram models.Program, db *sql.DB) error {
-	query := `UPDATE programs SET name = @name, description = @description, host = @host, category = @category, in_production = @in_production WHERE id = @id;`
-
-	_, err := db.Exec(query,
-		sql.Named("name", updatedProgram.Name),
-		sql.Named("description", updatedProgram.Description),
-		sql.Named("host", updatedProgram.Host),
-		sql.Named("category", updatedProgram.Category),
-		sql.Named("in_production", updatedProgram.InProduction),
-		sql.Named("id", programID),
-	)
-
-	if err != nil {
-		return err
-	}
+// PatchProgramByID Update the columns of a program changed by a patch, if the program is still at the version of
+// current. It returns the names of the changed columns along with the new version
+func PatchProgramByID(ctx context.Context, programID uint, current models.Program, patched models.Program, db *sql.DB) (Patched, error) {
+	return runQuery(ctx, "PatchProgramByID", func(ctx context.Context) (_ Patched, err error) {
+		result, err := patchRow(ctx, "programs", programID, current.Version, []column{
+			{"name", current.Name, patched.Name},
+			{"description", current.Description, patched.Description},
+			{"host", current.Host, patched.Host},
+			{"category", current.Category, patched.Category},
+			{"in_production", current.InProduction, patched.InProduction},
+			{"publish_at", current.PublishAt, patched.PublishAt},
+		}, db)
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, missingRow(ctx, "programs", programID, apperrors.NotFound("program_not_found", "Program not found"), db)
+		}
+		if err != nil {
+			return result, err
+		}
 
-	log.Printf("Program updated: %+v\n", updatedProgram.Name)
+		slog.InfoContext(ctx, "Program patched", "id", programID, "columns", result.Changed)
+		return result, nil
+	})
+}
 
-	return nil
+// DeleteProgram Delete program if its version is still version, any when 0
+func DeleteProgram(ctx context.Context, programID uint, version uint64, db *sql.DB) error {
+	return runExec(withVersion(ctx, version), "DeleteProgram", func(ctx context.Context) (err error) {
+		query := `DELETE FROM programs WHERE id = @p1 AND ` + versionFilter + `;`
+		result, err := db.ExecContext(ctx, query, sql.Named("p1", programID), versionArg(version))
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return missingRow(ctx, "programs", programID, apperrors.NotFound("program_not_found", "Program not found"), db)
+		}
+		slog.InfoContext(ctx, "Deleted program", "id", programID)
+		return nil
+	})
 }
 
-// DeleteProgram Delete program
-func DeleteProgram(programID uint, db *sql.DB) error {
-	query := `DELETE FROM programs WHERE id = @p1;`
-	_, err := db.Exec(query, sql.Named("p1", programID))
-	if err != nil {
-		return err
-	}
-	log.Printf("Deleted program: %+v\n", programID)
-	return nil
+// CountPrograms Count all programs, embargoed ones included
+func CountPrograms(ctx context.Context, db *sql.DB) (int, error) {
+	return runQuery(ctx, "CountPrograms", func(ctx context.Context) (_ int, err error) {
+		var count int
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM programs;`).Scan(&count)
+		return count, err
+	})
 }
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// releaseEmbargoed Lift the embargo of the rows of a table whose publish_at has passed, returning their ids
+func releaseEmbargoed(ctx context.Context, table string, db *sql.DB) ([]uint, error) {
+	query := `DECLARE @released TABLE (id INT);
+		UPDATE ` + table + ` SET embargoed = 0 OUTPUT inserted.id INTO @released WHERE embargoed = 1 AND publish_at <= GETUTCDATE();
+		SELECT id FROM @released;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "Error closing rows", "error", err)
+		}
+	}(rows)
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		slog.InfoContext(ctx, "Released embargoed rows", "table", table, "count", len(ids))
+		clearStaleReads(table)
+	}
+	return ids, nil
+}
+
+// ReleaseEmbargoedPrograms Make visible the embargoed programs whose publish_at has passed
+func ReleaseEmbargoedPrograms(ctx context.Context, db *sql.DB) ([]uint, error) {
+	return runQuery(ctx, "ReleaseEmbargoedPrograms", func(ctx context.Context) (_ []uint, err error) {
+		return releaseEmbargoed(ctx, TablePrograms, db)
+	})
+}
+
+// ReleaseEmbargoedSchedules Make visible the embargoed schedules whose publish_at has passed
+func ReleaseEmbargoedSchedules(ctx context.Context, db *sql.DB) ([]uint, error) {
+	return runQuery(ctx, "ReleaseEmbargoedSchedules", func(ctx context.Context) (_ []uint, err error) {
+		return releaseEmbargoed(ctx, TableSchedules, db)
+	})
+}
+
+// GetNextPublication Get the earliest publish_at among the embargoed programs and schedules, nil if there are none
+func GetNextPublication(ctx context.Context, db *sql.DB) (*time.Time, error) {
+	return runQuery(ctx, "GetNextPublication", func(ctx context.Context) (_ *time.Time, err error) {
+		query := `SELECT MIN(publish_at) FROM (
+				SELECT publish_at FROM programs WHERE embargoed = 1
+				UNION ALL
+				SELECT publish_at FROM schedules WHERE embargoed = 1
+			) embargoed;`
+		var next sql.NullTime
+		if err := db.QueryRowContext(ctx, query).Scan(&next); err != nil {
+			return nil, err
+		}
+		if !next.Valid {
+			return nil, nil
+		}
+		return &next.Time, nil
+	})
+}
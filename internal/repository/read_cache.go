@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"openprogramschedule/internal/cache"
+	"openprogramschedule/internal/models"
+	"slices"
+	"time"
+)
+
+// ReadCache Lifetime and number of entries of the caches of the public program and schedule reads, a TTL of 0
+// disabling them. Reads are cached by the data tag of their request, so the writes of any instance change their key,
+// and the writes of this server also clear them
+type ReadCache struct {
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// programCache and scheduleCache Set once at startup, before any query
+var (
+	programCache  = newReadCache("programs", ReadCache{TTL: 30 * time.Second, MaxEntries: 1000})
+	scheduleCache = newReadCache("schedules", ReadCache{TTL: 30 * time.Second, MaxEntries: 1000})
+)
+
+// SetReadCache Set the caches of the public reads, to be called before serving requests
+func SetReadCache(c ReadCache) {
+	programCache = newReadCache("programs", c)
+	scheduleCache = newReadCache("schedules", c)
+}
+
+// ReadCacheEntries Get the number of values of each cache of the public reads
+func ReadCacheEntries() map[string]int {
+	return map[string]int{programCache.Name(): programCache.Len(), scheduleCache.Name(): scheduleCache.Len()}
+}
+
+func newReadCache(name string, c ReadCache) *cache.Cache[any] {
+	return cache.New(name, c.TTL, c.MaxEntries, cloneRead)
+}
+
+// cloneRead Copy the result of a read, so the callers changing it do not change the cached one
+func cloneRead(value any) any {
+	switch value := value.(type) {
+	case *models.Program:
+		program := *value
+		return &program
+	case []models.Program:
+		return slices.Clone(value)
+	case *models.Schedule:
+		schedule := *value
+		return &schedule
+	case []models.Schedule:
+		return slices.Clone(value)
+	case *[]models.Schedule:
+		schedules := slices.Clone(*value)
+		return &schedules
+	}
+	return value
+}
+
+type dataTagKey struct{}
+
+// WithDataTag Attach to ctx the tag of the data version a response is validated with, queried before the rows. Public
+// reads are only cached along with a data tag, so a cached read is never older than the ETag it is sent with
+func WithDataTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, dataTagKey{}, tag)
+}
+
+// cachedRead Get the result of a public read from c by key and data tag, loading it with read on a miss. Reads without
+// a data tag, private reads, which precede the writes checking If-Match, and the reads of a repository function called
+// by another one always query
+func cachedRead[T any](ctx context.Context, c *cache.Cache[any], key string, publicOnly bool, read func() (T, error)) (T, error) {
+	tag, tagged := ctx.Value(dataTagKey{}).(string)
+	if !publicOnly || !tagged || ctx.Value(inQueryKey{}) != nil {
+		return read()
+	}
+	value, err := c.Load(key+"@"+tag, func() (any, error) {
+		result, err := read()
+		return result, err
+	})
+	result, _ := value.(T)
+	return result, err
+}
+
+// staleReads Table written by each write operation, whose cached reads it makes stale. Embargoed rows are released
+// every few seconds, the reads are only cleared when some were
+var staleReads = map[string]string{
+	"AddProgram":           TablePrograms,
+	"UpdateProgramByID":    TablePrograms,
+	"PatchProgramByID":     TablePrograms,
+	"DeleteProgram":        TablePrograms,
+	"AddSchedule":          TableSchedules,
+	"AddScheduleOverride":  TableSchedules,
+	"UpdateScheduleByID":   TableSchedules,
+	"PatchScheduleByID":    TableSchedules,
+	"UpdateScheduleStatus": TableSchedules,
+	"PublishScheduleRange": TableSchedules,
+	"DeleteScheduleByID":   TableSchedules,
+	"DeleteAllSchedules":   TableSchedules,
+	"AddHoliday":           TableHolidays,
+	"DeleteHoliday":        TableHolidays,
+	// Approved changes may create, update or delete programs as well as schedules
+	"ApproveChangeRequest": TablePrograms,
+}
+
+// clearStaleReads Clear the cached reads showing rows of table. Schedules are hidden along with their embargoed
+// program and changed by the holidays on date queries
+func clearStaleReads(table string) {
+	switch table {
+	case TablePrograms:
+		programCache.Purge()
+		scheduleCache.Purge()
+	case TableSchedules, TableHolidays, TableHolidaySubstitutions:
+		scheduleCache.Purge()
+	}
+}
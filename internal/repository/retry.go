@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/metrics"
+	"openprogramschedule/internal/resilience"
+	"time"
+)
+
+// Retries How transient errors are retried, and when the circuit breaker opens
+type Retries struct {
+	MaxAttempts      int
+	Backoff          resilience.Backoff
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// retries Set once at startup, before any query
+var (
+	retries = Retries{MaxAttempts: 3, Backoff: resilience.Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}}
+	breaker = &resilience.Breaker{Threshold: 5, Cooldown: 30 * time.Second}
+)
+
+// SetRetries Set the retries of the repository functions, to be called before serving requests
+func SetRetries(r Retries) {
+	retries = r
+	breaker = &resilience.Breaker{Threshold: r.BreakerThreshold, Cooldown: r.BreakerCooldown}
+}
+
+// BreakerState Get the state of the circuit breaker of the database
+func BreakerState() string {
+	return breaker.State()
+}
+
+// idempotentWrites Write operations leaving the database in the same state and returning the same result when run twice,
+// so they are retried even when the connection was lost while they ran. Reads are always idempotent. Lifting embargoes
+// is not: a retry of an applied release finds nothing left to release and loses the released ids, as publishing a
+// range loses its count. Neither are deletes by id, whose retry finds no row and fails with 404, patches and the writes
+// expecting a version, which a retry of the applied write fails with a newer one, see withVersion
+var idempotentWrites = map[string]bool{
+	"UpdateProgramByID":  true,
+	"UpdateScheduleByID": true,
+	"DeleteAllSchedules": true,
+}
+
+type inQueryKey struct{}
+
+// runQuery Run the body of a repository function with its timeout, through the circuit breaker, retrying transient errors
+// with backoff. Errors met before the statement was applied are always retried, as every write runs a single statement
+// or a transaction rolled back as a whole, the other transient ones only when the operation is idempotent. Timeouts and
+// cancellations are not retried and do not count as breaker failures, a slow query telling nothing about the others.
+// Repository functions called by another one run once, their caller retries
+func runQuery[T any](ctx context.Context, function string, run func(ctx context.Context) (T, error)) (result T, err error) {
+	ctx, done := startQuery(ctx, function)
+	defer done(&err)
+	if ctx.Value(inQueryKey{}) != nil {
+		return run(ctx)
+	}
+	ctx = context.WithValue(ctx, inQueryKey{}, true)
+
+	for attempt := 0; ; attempt++ {
+		if err = breaker.Allow(); err != nil {
+			return result, apperrors.Unavailable("database_unavailable", "Database unavailable", fmt.Errorf("%s: %w", function, err))
+		}
+		result, err = run(ctx)
+		transience := resilience.Classify(err)
+		switch {
+		case ctx.Err() != nil:
+			breaker.Record(resilience.Ignored)
+			return result, err
+		case transience != resilience.Permanent:
+			breaker.Record(resilience.Failure)
+		default:
+			breaker.Record(resilience.Success)
+			return result, err
+		}
+		idempotent := idempotentWrites[function] && ctx.Value(versionedKey{}) == nil
+		retryable := transience == resilience.Rejected || readOperations[function] || idempotent
+		if !retryable || attempt+1 >= retries.MaxAttempts {
+			return result, apperrors.Unavailable("database_unavailable", "Database unavailable", fmt.Errorf("%s: %w", function, err))
+		}
+		slog.WarnContext(ctx, "Retrying after a transient database error", "function", function, "attempt", attempt+1, "error", err)
+		metrics.DBQueryRetries.Inc(function)
+		if resilience.Wait(ctx, retries.Backoff.Delay(attempt)) != nil {
+			return result, err
+		}
+	}
+}
+
+// runExec Run the body of a repository function returning only an error, as runQuery does
+func runExec(ctx context.Context, function string, run func(ctx context.Context) error) error {
+	_, err := runQuery(ctx, function, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, run(ctx)
+	})
+	return err
+}
@@ -1,251 +1,743 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"openprogramschedule/internal/apperrors"
 	"openprogramschedule/internal/models"
+	"openprogramschedule/internal/validators"
+	"strings"
 	"time"
 )
 
-// IT
-var daysOfTheWeek = map[int]string{
-	1: "Lunedi",
-	2: "Martedi",
-	3: "Mercoledi",
-	4: "Giovedi",
-	5: "Venerdi",
-	6: "Sabato",
-	7: "Domenica",
+// preemptionSource Join every schedule s with the published override o, if any, preempting it. Overrides cannot overlap,
+// see checkOverrideOverlap, so a schedule has at most one, the earliest winning among rows written before the rule
+const preemptionSource = `FROM schedules s
+OUTER APPLY (
+    SELECT TOP 1 ov.id, ov.override_reason FROM schedules ov
+    WHERE s.is_override = 0 AND ov.is_override = 1 AND ov.status IN ('published', 'aired') AND ov.embargoed = 0
+    AND s.date >= ov.date AND s.date < ov.end_date
+    ORDER BY ov.date
+) o`
+
+// scheduleQuery Select every schedule column along with the published override, if any, preempting it
+const scheduleQuery = `SELECT s.id, s.program_id, s.description, s.day, s.date, s.end_date, s.is_override, s.override_reason, s.status, s.publish_at,
+    CAST(s.row_version AS BIGINT), o.id, o.override_reason
+` + preemptionSource
+
+// visibleFilter Restrict the schedules to the published and aired ones, out of embargo along with their program, when @public is set
+const visibleFilter = `(@public = 0 OR (s.status IN ('published', 'aired') AND s.embargoed = 0
+    AND NOT EXISTS (SELECT 1 FROM programs p WHERE p.id = s.program_id AND p.embargoed = 1)))`
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// AddSchedule Create a schedule
-func AddSchedule(schedule *models.Schedule, db *sql.DB) (uint, error) {
-	_, err := GetProgramByID(schedule.ProgramId, db)
+// querier Run statements on the database or in a transaction, so the writes of a repository function can be part of the
+// transaction of another one
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func scanSchedule(row rowScanner) (models.Schedule, error) {
+	var schedule models.Schedule
+	err := row.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date,
+		&schedule.EndDate, &schedule.IsOverride, &schedule.OverrideReason, &schedule.Status, &schedule.PublishAt, &schedule.Version, &schedule.PreemptedBy, &schedule.PreemptionReason)
+	schedule.Preempted = schedule.PreemptedBy != nil
+	return schedule, err
+}
+
+// checkProgramReference Get the program referenced by field, failing with a field error when it does not exist
+func checkProgramReference(ctx context.Context, field string, programID uint, db *sql.DB) (*models.Program, error) {
+	program, err := GetProgramByID(ctx, programID, false, db)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, apperrors.Invalid([]apperrors.FieldError{{Field: field, Code: "unknown_reference", Message: field + " does not match any program"}})
+	}
+	return program, err
+}
+
+// checkScheduleProgram Check the program of a schedule exists and, when the check is enabled, is in production
+func checkScheduleProgram(ctx context.Context, programID uint, db *sql.DB) error {
+	program, err := checkProgramReference(ctx, "program_id", programID, db)
 	if err != nil {
-		return 0, errors.New("could not get program")
+		return err
+	}
+	if validators.Enabled(validators.CheckScheduleProgramInProduction) && (program.InProduction == nil || !*program.InProduction) {
+		return apperrors.Invalid([]apperrors.FieldError{{Field: "program_id", Code: "not_in_production", Message: "program_id must reference a program in production"}})
 	}
-	query := `INSERT INTO schedules (program_id, description, day, date)
-			VALUES (@p1, @p2, @p3, @p4);
+	return nil
+}
+
+// AddSchedule Create a schedule
+func AddSchedule(ctx context.Context, schedule *models.Schedule, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddSchedule", func(ctx context.Context) (_ uint, err error) {
+		if err = checkScheduleProgram(ctx, schedule.ProgramId, db); err != nil {
+			return 0, err
+		}
+		return addSchedule(ctx, schedule, db)
+	})
+}
+
+// addSchedule Insert a schedule whose program was checked
+func addSchedule(ctx context.Context, schedule *models.Schedule, q querier) (uint, error) {
+	if schedule.Status == "" {
+		schedule.Status = models.ScheduleStatusDraft
+	}
+	query := `INSERT INTO schedules (program_id, description, day, date, status, publish_at, embargoed)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, CASE WHEN @p6 > GETUTCDATE() THEN 1 ELSE 0 END);
 			SELECT SCOPE_IDENTITY() AS id`
 
-	row := db.QueryRow(query,
+	row := q.QueryRowContext(ctx, query,
 		sql.Named("p1", schedule.ProgramId),
 		sql.Named("p2", schedule.Description),
 		sql.Named("p3", schedule.Day),
 		sql.Named("p4", schedule.Date),
+		sql.Named("p5", schedule.Status),
+		sql.Named("p6", schedule.PublishAt),
 	)
 
 	var id uint
-	err = row.Scan(&id)
-	if err != nil {
+	if err := row.Scan(&id); err != nil {
 		return 0, err
 	}
-	log.Printf("Added schedule with id: %d", id)
+	slog.InfoContext(ctx, "Added schedule", "id", id)
 	return id, nil
 }
 
-// GetAllSchedules Get all schedules
-func GetAllSchedules(db *sql.DB) ([]models.Schedule, error) {
-	query := `SELECT * FROM schedules`
-	rows, err := db.Query(query)
+// AddScheduleOverride Create an override preempting the regular schedules between its date and end date, failing with a
+// conflict when its window overlaps another override
+func AddScheduleOverride(ctx context.Context, schedule *models.Schedule, db *sql.DB) (uint, error) {
+	return runQuery(ctx, "AddScheduleOverride", func(ctx context.Context) (_ uint, err error) {
+		if err = checkScheduleProgram(ctx, schedule.ProgramId, db); err != nil {
+			return 0, err
+		}
+		if schedule.Status == "" {
+			schedule.Status = models.ScheduleStatusDraft
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		if err = checkOverrideOverlap(ctx, 0, *schedule, tx); err != nil {
+			return 0, err
+		}
+		query := `INSERT INTO schedules (program_id, description, day, date, end_date, is_override, override_reason, status, publish_at, embargoed)
+				VALUES (@p1, @p2, @p3, @p4, @p5, 1, @p6, @p7, @p8, CASE WHEN @p8 > GETUTCDATE() THEN 1 ELSE 0 END);
+				SELECT SCOPE_IDENTITY() AS id`
+
+		row := tx.QueryRowContext(ctx, query,
+			sql.Named("p1", schedule.ProgramId),
+			sql.Named("p2", schedule.Description),
+			sql.Named("p3", schedule.Day),
+			sql.Named("p4", schedule.Date),
+			sql.Named("p5", schedule.EndDate),
+			sql.Named("p6", schedule.OverrideReason),
+			sql.Named("p7", schedule.Status),
+			sql.Named("p8", schedule.PublishAt),
+		)
+
+		var id uint
+		err = row.Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		slog.InfoContext(ctx, "Added schedule override", "id", id)
+		return id, nil
+	})
+}
+
+// checkOverrideOverlap Fail with a conflict when the window of override, whose id is overrideID, 0 for a new one,
+// overlaps another override that is not cancelled, drafts included as they may be published. The overrides read are
+// locked until the end of the transaction of q, so two overlapping overrides cannot be written concurrently
+func checkOverrideOverlap(ctx context.Context, overrideID uint, override models.Schedule, q querier) error {
+	if override.EndDate == nil {
+		return nil
+	}
+	query := `SELECT TOP 1 id FROM schedules WITH (UPDLOCK, HOLDLOCK)
+		WHERE is_override = 1 AND status <> @cancelled AND id <> @id AND date < @end_date AND end_date > @date;`
+	var overlapping uint
+	err := q.QueryRowContext(ctx, query,
+		sql.Named("cancelled", models.ScheduleStatusCancelled),
+		sql.Named("id", overrideID),
+		sql.Named("date", override.Date),
+		sql.Named("end_date", override.EndDate),
+	).Scan(&overlapping)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var schedules []models.Schedule
-	for rows.Next() {
-		var schedule models.Schedule
-		err := rows.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date)
+	return apperrors.Conflict("override_overlap", fmt.Sprintf("The override overlaps override %d", overlapping))
+}
+
+// GetScheduleOverrides Get all schedule overrides, only the published ones if publicOnly is set
+func GetScheduleOverrides(ctx context.Context, publicOnly bool, db *sql.DB) ([]models.Schedule, error) {
+	return cachedRead(ctx, scheduleCache, "overrides", publicOnly, func() ([]models.Schedule, error) {
+		return runQuery(ctx, "GetScheduleOverrides", func(ctx context.Context) (_ []models.Schedule, err error) {
+			query := scheduleQuery + ` WHERE s.is_override = 1 AND ` + visibleFilter + ` ORDER BY s.date;`
+			rows, err := db.QueryContext(ctx, query, sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer func(rows *sql.Rows) {
+				err := rows.Close()
+				if err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}(rows)
+
+			var schedules []models.Schedule
+			for rows.Next() {
+				schedule, err := scanSchedule(rows)
+				if err != nil {
+					return nil, err
+				}
+				schedules = append(schedules, schedule)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+			return schedules, nil
+		})
+	})
+}
+
+// GetSchedulesPreemptedBy Get the regular schedules preempted by an override
+func GetSchedulesPreemptedBy(ctx context.Context, overrideID uint, db *sql.DB) ([]models.Schedule, error) {
+	return runQuery(ctx, "GetSchedulesPreemptedBy", func(ctx context.Context) (_ []models.Schedule, err error) {
+		query := scheduleQuery + ` WHERE o.id = @p1 ORDER BY s.date;`
+		rows, err := db.QueryContext(ctx, query, sql.Named("p1", overrideID))
 		if err != nil {
 			return nil, err
 		}
-		schedules = append(schedules, schedule)
-	}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error closing rows", "error", err)
+			}
+		}(rows)
+
+		var schedules []models.Schedule
+		for rows.Next() {
+			schedule, err := scanSchedule(rows)
+			if err != nil {
+				return nil, err
+			}
+			schedules = append(schedules, schedule)
+		}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return schedules, nil
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return schedules, nil
+	})
 }
 
-// GetScheduleByID Get a schedule by its ID
-func GetScheduleByID(scheduleID uint, db *sql.DB) (*models.Schedule, error) {
-	query := `SELECT id, program_id, description, day, date FROM schedules WHERE id = @p1;`
-	row := db.QueryRow(query, sql.Named("p1", scheduleID))
-	var schedule models.Schedule
-	err := row.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date)
-	if err != nil {
-		return nil, err
-	}
+// GetAllSchedules Get all schedules, only the published ones if publicOnly is set
+func GetAllSchedules(ctx context.Context, publicOnly bool, db *sql.DB) ([]models.Schedule, error) {
+	return cachedRead(ctx, scheduleCache, "all", publicOnly, func() ([]models.Schedule, error) {
+		return runQuery(ctx, "GetAllSchedules", func(ctx context.Context) (_ []models.Schedule, err error) {
+			query := scheduleQuery + ` WHERE ` + visibleFilter
+			rows, err := db.QueryContext(ctx, query, sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+			var schedules []models.Schedule
+			for rows.Next() {
+				schedule, err := scanSchedule(rows)
+				if err != nil {
+					return nil, err
+				}
+				schedules = append(schedules, schedule)
+			}
+
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+			return schedules, nil
+		})
+	})
+}
 
-	return &schedule, nil
+// GetScheduleByID Get a schedule by its ID, only if published when publicOnly is set
+func GetScheduleByID(ctx context.Context, scheduleID uint, publicOnly bool, db *sql.DB) (*models.Schedule, error) {
+	return cachedRead(ctx, scheduleCache, fmt.Sprint("id:", scheduleID), publicOnly, func() (*models.Schedule, error) {
+		return runQuery(ctx, "GetScheduleByID", func(ctx context.Context) (_ *models.Schedule, err error) {
+			query := scheduleQuery + ` WHERE s.id = @p1 AND ` + visibleFilter + `;`
+			row := db.QueryRowContext(ctx, query, sql.Named("p1", scheduleID), sql.Named("public", publicOnly))
+			schedule, err := scanSchedule(row)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, apperrors.NotFound("schedule_not_found", "Schedule not found")
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			return &schedule, nil
+		})
+	})
 }
 
-// GetScheduleByProgramID Get the schedule of a program using its ID
-func GetScheduleByProgramID(programId uint, db *sql.DB) (*[]models.Schedule, error) {
-	_, err := GetProgramByID(programId, db)
-	if err != nil {
-		return nil, errors.New("could not get program")
+// GetScheduleByProgramID Get the schedule of a program using its ID, only the published ones if publicOnly is set
+func GetScheduleByProgramID(ctx context.Context, programId uint, publicOnly bool, db *sql.DB) (*[]models.Schedule, error) {
+	return cachedRead(ctx, scheduleCache, fmt.Sprint("program:", programId), publicOnly, func() (*[]models.Schedule, error) {
+		return runQuery(ctx, "GetScheduleByProgramID", func(ctx context.Context) (_ *[]models.Schedule, err error) {
+			_, err = GetProgramByID(ctx, programId, publicOnly, db)
+			if err != nil {
+				return nil, err
+			}
+			query := scheduleQuery + ` WHERE s.program_id = @p1 AND ` + visibleFilter
+			rows, err := db.QueryContext(ctx, query, sql.Named("p1", programId), sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if err := rows.Close(); err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}()
+
+			var schedules []models.Schedule
+			for rows.Next() {
+				schedule, err := scanSchedule(rows)
+				if err != nil {
+					return nil, err
+				}
+				schedules = append(schedules, schedule)
+			}
+
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+			return &schedules, nil
+		})
+	})
+}
+
+// The day parameter should be an integer representing the day of the week (1 for Monday, 7 for Sunday). Days are in italian (models.DaysOfTheWeek).
+// When the next date falling on day, today included, is a holiday of the country and region the weekly lineup of the
+// holiday lineup day, if any, is returned instead and the holiday program substitutions are applied
+func GetScheduleByDay(ctx context.Context, day int, country string, region string, publicOnly bool, db *sql.DB) (*[]models.Schedule, error) {
+	next := nextWeekday(time.Now().UTC(), day)
+	key := fmt.Sprintf("day:%d:%q:%q:%s", day, country, region, next.Format("2006-01-02"))
+	return cachedRead(ctx, scheduleCache, key, publicOnly, func() (*[]models.Schedule, error) {
+		return runQuery(ctx, "GetScheduleByDay", func(ctx context.Context) (_ *[]models.Schedule, err error) {
+			if day < 1 || day > len(models.DaysOfTheWeek) {
+				return nil, apperrors.Validation("invalid_day", "Day must be between 1 and 7")
+			}
+
+			var holiday *models.Holiday
+			if country != "" {
+				holiday, err = GetHolidayForDate(ctx, next, country, region, db)
+				if err != nil {
+					return nil, err
+				}
+			}
+			dayName := models.DaysOfTheWeek[day-1]
+			if holiday != nil && holiday.LineupDay != nil {
+				dayName = models.DaysOfTheWeek[*holiday.LineupDay-1]
+			}
+
+			query := scheduleQuery + ` WHERE s.day = @p1 AND ` + visibleFilter + `;`
+			rows, err := db.QueryContext(ctx, query, sql.Named("p1", dayName), sql.Named("public", publicOnly))
+			if err != nil {
+				return nil, err
+			}
+			defer func(rows *sql.Rows) {
+				err := rows.Close()
+				if err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}(rows)
+
+			var schedules []models.Schedule
+
+			for rows.Next() {
+				schedule, err := scanSchedule(rows)
+				if err != nil {
+					return nil, err
+				}
+				schedules = append(schedules, schedule)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+
+			if holiday != nil {
+				applyHoliday(holiday, schedules)
+			}
+			return &schedules, nil
+		})
+	})
+}
+
+// nextWeekday Get the first date falling on day (1 for Monday, 7 for Sunday) from the date of from, included
+func nextWeekday(from time.Time, day int) time.Time {
+	date := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	weekday := (int(date.Weekday())+6)%7 + 1
+	return date.AddDate(0, 0, (day-weekday+7)%7)
+}
+
+// weekdayOf Get the date falling on day (1 for Monday, 7 for Sunday) in the week, from Monday to Sunday, of date
+func weekdayOf(date time.Time, day int) time.Time {
+	weekday := (int(date.Weekday())+6)%7 + 1
+	return date.AddDate(0, 0, day-weekday)
+}
+
+// GetScheduleByDate Get the schedule of a date (es. 2024-06-30). When the date is a holiday of the country and region
+// the holiday lineup day, if any, replaces the regular lineup and the holiday program substitutions are applied.
+// Only the published schedules are returned if publicOnly is set
+func GetScheduleByDate(ctx context.Context, date string, country string, region string, publicOnly bool, db *sql.DB) (*[]models.Schedule, error) {
+	return cachedRead(ctx, scheduleCache, fmt.Sprintf("date:%s:%q:%q", date, country, region), publicOnly, func() (*[]models.Schedule, error) {
+		return runQuery(ctx, "GetScheduleByDate", func(ctx context.Context) (_ *[]models.Schedule, err error) {
+			dateTime, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				return nil, apperrors.Validation("invalid_date", "Date must be in the YYYY-MM-DD format")
+			}
+			start := time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), 0, 0, 0, 0, time.UTC)
+			end := start.AddDate(0, 0, 1)
+
+			var holiday *models.Holiday
+			if country != "" {
+				holiday, err = GetHolidayForDate(ctx, start, country, region, db)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			query := scheduleQuery + ` WHERE s.date >= @p1 AND s.date <= @p2 AND ` + visibleFilter + `;`
+			args := []any{sql.Named("p1", start), sql.Named("p2", end), sql.Named("public", publicOnly)}
+			if holiday != nil && holiday.LineupDay != nil {
+				// The regular schedules of the holiday lineup day in the same week replace the ones of the date, overrides still air
+				lineupStart := weekdayOf(start, *holiday.LineupDay)
+				query = scheduleQuery + ` WHERE ((s.is_override = 0 AND s.day = @p3 AND s.date >= @p4 AND s.date < @p5)
+					OR (s.is_override = 1 AND s.date >= @p1 AND s.date <= @p2))
+					AND ` + visibleFilter + `;`
+				args = append(args,
+					sql.Named("p3", models.DaysOfTheWeek[*holiday.LineupDay-1]),
+					sql.Named("p4", lineupStart),
+					sql.Named("p5", lineupStart.AddDate(0, 0, 1)),
+				)
+			}
+			rows, err := db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return nil, err
+			}
+			defer func(rows *sql.Rows) {
+				err := rows.Close()
+				if err != nil {
+					slog.ErrorContext(ctx, "Error closing rows", "error", err)
+				}
+			}(rows)
+
+			var schedules []models.Schedule
+			for rows.Next() {
+				schedule, err := scanSchedule(rows)
+				if err != nil {
+					return nil, err
+				}
+				schedules = append(schedules, schedule)
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+
+			if holiday != nil {
+				applyHoliday(holiday, schedules)
+			}
+			return &schedules, nil
+		})
+	})
+}
+
+// UpdateScheduleByID Update schedule by id if its version is still version, any when 0, returning the new version. The
+// end date and reason of an override, when updatedSchedule is one, are updated too, its window must not overlap another
+func UpdateScheduleByID(ctx context.Context, scheduleID uint, updatedSchedule models.Schedule, version uint64, db *sql.DB) (uint64, error) {
+	return runQuery(withVersion(ctx, version), "UpdateScheduleByID", func(ctx context.Context) (_ uint64, err error) {
+		if err = checkScheduleProgram(ctx, updatedSchedule.ProgramId, db); err != nil {
+			return 0, err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		if updatedSchedule.IsOverride {
+			if err = checkOverrideOverlap(ctx, scheduleID, updatedSchedule, tx); err != nil {
+				return 0, err
+			}
+		}
+		newVersion, err := updateSchedule(ctx, scheduleID, updatedSchedule, version, tx)
+		if err != nil {
+			return 0, err
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return newVersion, nil
+	})
+}
+
+// updateSchedule Update a schedule whose program was checked, if its version is still version, any when 0. The override
+// columns are only written when updatedSchedule is an override, and only to a row that is one
+func updateSchedule(ctx context.Context, scheduleID uint, updatedSchedule models.Schedule, version uint64, q querier) (uint64, error) {
+	overrideColumns := ""
+	if updatedSchedule.IsOverride {
+		overrideColumns = `end_date = CASE WHEN is_override = 1 THEN @end_date ELSE end_date END,
+			override_reason = CASE WHEN is_override = 1 THEN @override_reason ELSE override_reason END, `
+	}
+	query := returningVersion(`UPDATE schedules SET program_id = @program_id, description = @description, day = @day, date = @date,
+			` + overrideColumns + `publish_at = @publish_at, embargoed = CASE WHEN @publish_at > GETUTCDATE() THEN 1 ELSE 0 END
+			` + versionOutput + ` WHERE id = @id AND ` + versionFilter + `;`)
+
+	var newVersion uint64
+	err := q.QueryRowContext(ctx, query,
+		sql.Named("program_id", updatedSchedule.ProgramId),
+		sql.Named("description", updatedSchedule.Description),
+		sql.Named("day", updatedSchedule.Day),
+		sql.Named("date", updatedSchedule.Date),
+		sql.Named("end_date", updatedSchedule.EndDate),
+		sql.Named("override_reason", updatedSchedule.OverrideReason),
+		sql.Named("publish_at", updatedSchedule.PublishAt),
+		sql.Named("id", scheduleID),
+		versionArg(version),
+	).Scan(&newVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, missingRow(ctx, "schedules", scheduleID, apperrors.NotFound("schedule_not_found", "Schedule not found"), q)
 	}
-	query := `SELECT id, program_id, description, day, date FROM schedules WHERE program_id = @p1`
-	rows, err := db.Query(query, sql.Named("p1", programId))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("Error closing rows: %v", err)
+
+	slog.InfoContext(ctx, "Updated schedule", "id", scheduleID)
+
+	return newVersion, nil
+}
+
+// PatchScheduleByID Update the columns of a schedule changed by a patch, if the schedule is still at the version of
+// current. It returns the names of the changed columns along with the new version. A changed program_id must
+// reference a program, as when adding a schedule, and the window of an override must not overlap another
+func PatchScheduleByID(ctx context.Context, scheduleID uint, current models.Schedule, patched models.Schedule, db *sql.DB) (Patched, error) {
+	return runQuery(ctx, "PatchScheduleByID", func(ctx context.Context) (_ Patched, err error) {
+		if patched.ProgramId != current.ProgramId {
+			if err = checkScheduleProgram(ctx, patched.ProgramId, db); err != nil {
+				return Patched{}, err
+			}
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return Patched{}, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		if current.IsOverride {
+			if err = checkOverrideOverlap(ctx, scheduleID, patched, tx); err != nil {
+				return Patched{}, err
+			}
+		}
+		result, err := patchRow(ctx, "schedules", scheduleID, current.Version, []column{
+			{"program_id", current.ProgramId, patched.ProgramId},
+			{"description", current.Description, patched.Description},
+			{"day", current.Day, patched.Day},
+			{"date", current.Date, patched.Date},
+			{"end_date", current.EndDate, patched.EndDate},
+			{"override_reason", current.OverrideReason, patched.OverrideReason},
+			{"publish_at", current.PublishAt, patched.PublishAt},
+		}, tx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, missingRow(ctx, "schedules", scheduleID, apperrors.NotFound("schedule_not_found", "Schedule not found"), tx)
+		}
+		if err != nil {
+			return result, err
+		}
+		if err = tx.Commit(); err != nil {
+			return Patched{}, fmt.Errorf("failed to commit transaction: %w", err)
 		}
-	}()
 
-	var schedules []models.Schedule
-	for rows.Next() {
-		var schedule models.Schedule
-		err := rows.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date)
+		slog.InfoContext(ctx, "Schedule patched", "id", scheduleID, "columns", result.Changed)
+		return result, nil
+	})
+}
+
+// UpdateScheduleStatus Move a schedule from a status to another if its version is still version, any when 0, failing
+// if it is no longer in the from status. It returns the new version
+func UpdateScheduleStatus(ctx context.Context, scheduleID uint, from string, to string, version uint64, db *sql.DB) (uint64, error) {
+	return runQuery(ctx, "UpdateScheduleStatus", func(ctx context.Context) (_ uint64, err error) {
+		query := returningVersion(`UPDATE schedules SET status = @to ` + versionOutput + `
+		             WHERE id = @id AND status = @from AND ` + versionFilter + `;`)
+		var newVersion uint64
+		err = db.QueryRowContext(ctx, query,
+			sql.Named("to", to),
+			sql.Named("id", scheduleID),
+			sql.Named("from", from),
+			versionArg(version),
+		).Scan(&newVersion)
+		if errors.Is(err, sql.ErrNoRows) {
+			if version != 0 {
+				return 0, missingRow(ctx, "schedules", scheduleID, apperrors.NotFound("schedule_not_found", "Schedule not found"), db)
+			}
+			return 0, apperrors.Conflict("schedule_status_changed", "Schedule status changed concurrently")
+		}
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		schedules = append(schedules, schedule)
-	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return &schedules, nil
+		slog.InfoContext(ctx, "Moved schedule", "id", scheduleID, "from", from, "to", to)
+		return newVersion, nil
+	})
 }
 
-// The day parameter should be an integer representing the day of the week (1 for Monday, 7 for Sunday). Days are in italian (daysOfTheWeek)
-func GetScheduleByDay(day int, db *sql.DB) (*[]models.Schedule, error) {
-	dayName, exists := daysOfTheWeek[day]
-	if !exists {
-		return nil, errors.New("invalid day number")
-	}
+// PublishScheduleRange Publish every draft schedule airing between from (inclusive) and to (exclusive)
+func PublishScheduleRange(ctx context.Context, from time.Time, to time.Time, db *sql.DB) (int64, error) {
+	return runQuery(ctx, "PublishScheduleRange", func(ctx context.Context) (_ int64, err error) {
+		query := `UPDATE schedules SET status = @published WHERE status = @draft AND date >= @from AND date < @to;`
+		result, err := db.ExecContext(ctx, query,
+			sql.Named("published", models.ScheduleStatusPublished),
+			sql.Named("draft", models.ScheduleStatusDraft),
+			sql.Named("from", from),
+			sql.Named("to", to),
+		)
+		if err != nil {
+			return 0, err
+		}
 
-	query := `SELECT id, program_id, description, day, date FROM schedules WHERE day = @p1;`
-	rows, err := db.Query(query, sql.Named("p1", dayName))
-	if err != nil {
-		return nil, err
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
+		rowsAffected, err := result.RowsAffected()
 		if err != nil {
-			log.Printf("Error closing rows: %v", err)
+			return 0, fmt.Errorf("failed to get rows affected: %w", err)
 		}
-	}(rows)
 
-	var schedules []models.Schedule
+		slog.InfoContext(ctx, "Published schedules", "count", rowsAffected, "from", from.Format(time.DateOnly), "to", to.Format(time.DateOnly))
+		return rowsAffected, nil
+	})
+}
 
-	for rows.Next() {
-		var schedule models.Schedule
-		err = rows.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date)
+// DeleteScheduleByID Delete schedule by id if its version is still version, any when 0. It returns the ids of the regular
+// schedules the deleted override preempted and no other published override still preempts, restored by the delete
+func DeleteScheduleByID(ctx context.Context, scheduleID uint, version uint64, db *sql.DB) ([]uint, error) {
+	return runQuery(withVersion(ctx, version), "DeleteScheduleByID", func(ctx context.Context) (_ []uint, err error) {
+		tx, err := db.BeginTx(ctx, nil)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
 		}
-		schedules = append(schedules, schedule)
-	}
+		defer tx.Rollback()
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+		preempted, err := preemptedIDs(ctx, `o.id = @id`, []any{sql.Named("id", scheduleID)}, tx)
+		if err != nil {
+			return nil, err
+		}
+		if err = deleteSchedule(ctx, scheduleID, version, tx); err != nil {
+			return nil, err
+		}
+		restored := []uint{}
+		if len(preempted) > 0 {
+			placeholders := make([]string, len(preempted))
+			args := make([]any, len(preempted))
+			for i, id := range preempted {
+				placeholders[i] = fmt.Sprintf("@s%d", i)
+				args[i] = sql.Named(fmt.Sprintf("s%d", i), id)
+			}
+			restored, err = preemptedIDs(ctx, `s.id IN (`+strings.Join(placeholders, ", ")+`) AND o.id IS NULL`, args, tx)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	return &schedules, nil
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return restored, nil
+	})
 }
 
-// GetScheduleByDate Get the schedule of a date (es. 2024-06-30)
-func GetScheduleByDate(date string, db *sql.DB) (*[]models.Schedule, error) {
-	dateTime, err := time.Parse("2006-01-02", date)
-	if err != nil {
-		return nil, err
-	}
-	start := time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), 0, 0, 0, 0, time.UTC)
-	end := start.AddDate(0, 0, 1)
-
-	query := `SELECT id, program_id, description, day, date FROM schedules WHERE date >= @p1 AND date <= @p2;`
-	rows, err := db.Query(query, sql.Named("p1", start), sql.Named("p2", end))
+// preemptedIDs Get the ids of the schedules matching filter, a condition on the schedule s and its preempting override o
+func preemptedIDs(ctx context.Context, filter string, args []any, q querier) ([]uint, error) {
+	rows, err := q.QueryContext(ctx, `SELECT s.id `+preemptionSource+` WHERE `+filter+` ORDER BY s.date;`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer func(rows *sql.Rows) {
 		err := rows.Close()
 		if err != nil {
-			log.Printf("Error closing rows: %v", err)
+			slog.ErrorContext(ctx, "Error closing rows", "error", err)
 		}
 	}(rows)
 
-	var schedules []models.Schedule
+	ids := []uint{}
 	for rows.Next() {
-		var schedule models.Schedule
-		err = rows.Scan(&schedule.Id, &schedule.ProgramId, &schedule.Description, &schedule.Day, &schedule.Date)
-		if err != nil {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		schedules = append(schedules, schedule)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+		ids = append(ids, id)
 	}
-
-	return &schedules, nil
+	return ids, rows.Err()
 }
 
-// UpdateScheduleByID
-func UpdateScheduleByID(scheduleID uint, updatedSchedule models.Schedule, db *sql.DB) error {
-	query := `UPDATE schedules SET program_id = @program_id, description = @description, day = @day, date = @date WHERE id = @id;`
-
-	_, err := db.Exec(query,
-		sql.Named("program_id", updatedSchedule.ProgramId),
-		sql.Named("description", updatedSchedule.Description),
-		sql.Named("day", updatedSchedule.Day),
-		sql.Named("date", updatedSchedule.Date),
-		sql.Named("id", scheduleID),
-	)
-
+// deleteSchedule Delete a schedule if its version is still version, any when 0
+func deleteSchedule(ctx context.Context, scheduleID uint, version uint64, q querier) error {
+	query := `DELETE FROM schedules WHERE id = @p1 AND ` + versionFilter + `;`
+	result, err := q.ExecContext(ctx, query, sql.Named("p1", scheduleID), versionArg(version))
 	if err != nil {
 		return err
 	}
-
-	log.Println("Updated schedule with id:", scheduleID)
-
-	return nil
-}
-
-// DeleteScheduleByID
-func DeleteScheduleByID(scheduleID uint, db *sql.DB) error {
-	query := `DELETE FROM schedules WHERE id = @p1;`
-	_, err := db.Exec(query, sql.Named("p1", scheduleID))
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return missingRow(ctx, "schedules", scheduleID, apperrors.NotFound("schedule_not_found", "Schedule not found"), q)
 	}
-	log.Printf("Deleted schedule: %+v\n", scheduleID)
+	slog.InfoContext(ctx, "Deleted schedule", "id", scheduleID)
 	return nil
 }
 
 // DeleteAllSchedules
-func DeleteAllSchedules(db *sql.DB) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
+func DeleteAllSchedules(ctx context.Context, db *sql.DB) error {
+	return runExec(ctx, "DeleteAllSchedules", func(ctx context.Context) (err error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
 
-	query := `DELETE FROM schedules;`
-	result, err := tx.Exec(query)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to execute delete query: %v", err)
-	}
+		query := `DELETE FROM schedules;`
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to execute delete query: %w", err)
+		}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
-	}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
 
-	log.Printf("Deleted %d schedules", rowsAffected)
-	return nil
+		slog.InfoContext(ctx, "Deleted schedules", "count", rowsAffected)
+		return nil
+	})
+}
+
+// CountUpcomingSchedules Count the published schedules that have not started yet
+func CountUpcomingSchedules(ctx context.Context, db *sql.DB) (int, error) {
+	return runQuery(ctx, "CountUpcomingSchedules", func(ctx context.Context) (_ int, err error) {
+		var count int
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schedules WHERE status = 'published' AND date > GETUTCDATE();`).Scan(&count)
+		return count, err
+	})
 }
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Timeouts Upper bound of each repository function, 0 for none. Operations overrides the Read or Write timeout of single functions
+type Timeouts struct {
+	Read       time.Duration
+	Write      time.Duration
+	Operations map[string]time.Duration
+}
+
+// timeouts Set once at startup, before any query
+var timeouts = Timeouts{Read: 5 * time.Second, Write: 10 * time.Second}
+
+// SetTimeouts Set the timeouts of the repository functions, to be called before serving requests
+func SetTimeouts(t Timeouts) {
+	timeouts = t
+}
+
+// writeOperations Repository functions that modify the database, the other ones get the Read timeout
+var writeOperations = map[string]bool{
+	"AddProgram":                true,
+	"UpdateProgramByID":         true,
+	"PatchProgramByID":          true,
+	"DeleteProgram":             true,
+	"AddSchedule":               true,
+	"AddScheduleOverride":       true,
+	"UpdateScheduleByID":        true,
+	"PatchScheduleByID":         true,
+	"UpdateScheduleStatus":      true,
+	"PublishScheduleRange":      true,
+	"DeleteScheduleByID":        true,
+	"DeleteAllSchedules":        true,
+	"AddHoliday":                true,
+	"DeleteHoliday":             true,
+	"AddChangeRequest":          true,
+	"ApproveChangeRequest":      true,
+	"RejectChangeRequest":       true,
+	"AddApiKey":                 true,
+	"RotateApiKey":              true,
+	"RevokeApiKey":              true,
+	"ReleaseEmbargoedPrograms":  true,
+	"ReleaseEmbargoedSchedules": true,
+}
+
+// readOperations Repository functions that only read the database
+var readOperations = map[string]bool{
+	"GetProgramByID":          true,
+	"GetProgramByName":        true,
+	"GetProgramsByCategory":   true,
+	"GetAllPrograms":          true,
+	"CountPrograms":           true,
+	"GetScheduleOverrides":    true,
+	"GetSchedulesPreemptedBy": true,
+	"GetAllSchedules":         true,
+	"GetScheduleByID":         true,
+	"GetScheduleByProgramID":  true,
+	"GetScheduleByDay":        true,
+	"GetScheduleByDate":       true,
+	"CountUpcomingSchedules":  true,
+	"GetHolidayByID":          true,
+	"GetAllHolidays":          true,
+	"GetHolidayForDate":       true,
+	"GetChangeRequestByID":    true,
+	"GetChangeRequests":       true,
+	"GetApiKeyByID":           true,
+	"GetAllApiKeys":           true,
+	"GetApiKeyCredentials":    true,
+	"GetNextPublication":      true,
+	"GetDataVersion":          true,
+}
+
+// IsOperation Report whether function names a repository function, so per-function timeouts can be validated
+func IsOperation(function string) bool {
+	return writeOperations[function] || readOperations[function]
+}
+
+// startQuery Derive the context of a repository function, bounded by its timeout, and get the function to defer
+// with its named error, which releases the context and records the duration of the call.
+// Errors met once the context is done wrap its cause, e.g. context.DeadlineExceeded, so callers can tell them apart.
+// The cached reads made stale by a write are cleared once it ends, even when it failed, as it may have been applied
+func startQuery(ctx context.Context, function string) (context.Context, func(err *error)) {
+	start := time.Now()
+	timeout := timeouts.Read
+	if writeOperations[function] {
+		timeout = timeouts.Write
+	}
+	if override, found := timeouts.Operations[function]; found {
+		timeout = override
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil {
+			*err = fmt.Errorf("%s interrupted: %w (%v)", function, context.Cause(ctx), *err)
+		}
+		cancel()
+		clearStaleReads(staleReads[function])
+		observeQuery(function, start, err)
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"openprogramschedule/internal/apperrors"
+)
+
+// versionFilter Match the rows whose version is @version, any row when it is 0
+const versionFilter = `(@version = 0 OR row_version = CAST(@version AS BINARY(8)))`
+
+// versionOutput Output the new row version of the updated row into @updated, the tables written by this server having
+// triggers, which rule out OUTPUT without INTO
+const versionOutput = `OUTPUT CAST(inserted.row_version AS BIGINT) INTO @updated`
+
+// returningVersion Wrap an UPDATE using versionOutput in a batch selecting the new row version, no row when none matched
+func returningVersion(update string) string {
+	return `DECLARE @updated TABLE (version BIGINT);
+` + update + `
+SELECT version FROM @updated;`
+}
+
+// versionArg Pass an expected row version, 0 for any. Row versions fit in a BIGINT
+func versionArg(version uint64) sql.NamedArg {
+	return sql.Named("version", int64(version))
+}
+
+// missingRow Get the error of a write by id that matched no row: notFound when the row does not exist, a failed
+// precondition when it changed since the expected version was read
+func missingRow(ctx context.Context, table string, id uint, notFound error, q querier) error {
+	var exists bool
+	query := `SELECT CAST(CASE WHEN EXISTS (SELECT 1 FROM ` + table + ` WHERE id = @id) THEN 1 ELSE 0 END AS BIT);`
+	if err := q.QueryRowContext(ctx, query, sql.Named("id", id)).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return notFound
+	}
+	return VersionMismatch()
+}
+
+type versionedKey struct{}
+
+// withVersion Mark a write as expecting version when it is not 0. Such a write is never idempotent: once applied, a
+// retry finds a newer version and fails
+func withVersion(ctx context.Context, version uint64) context.Context {
+	if version == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, versionedKey{}, true)
+}
+
+// VersionMismatch The error of a write expecting a version the row no longer has
+func VersionMismatch() error {
+	return apperrors.PreconditionFailed("version_mismatch", "The resource was changed since the version given in If-Match")
+}
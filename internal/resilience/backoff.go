@@ -0,0 +1,38 @@
+package resilience
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff Exponential backoff with full jitter, so clients failing together do not retry together
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay Get a random delay before the retry following the given attempt, counted from 0,
+// up to BaseDelay doubled at each attempt and capped to MaxDelay
+func (backoff Backoff) Delay(attempt int) time.Duration {
+	ceiling := backoff.MaxDelay
+	if attempt < 32 && backoff.BaseDelay<<attempt < ceiling && backoff.BaseDelay<<attempt > 0 {
+		ceiling = backoff.BaseDelay << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// Wait Sleep for delay, returning early with the context error if ctx is done first
+func Wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
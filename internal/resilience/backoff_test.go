@@ -0,0 +1,32 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		attempt int
+		ceiling time.Duration
+	}{
+		{name: "first attempt", backoff: Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}, attempt: 0, ceiling: 100 * time.Millisecond},
+		{name: "doubled at each attempt", backoff: Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}, attempt: 3, ceiling: 800 * time.Millisecond},
+		{name: "capped", backoff: Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}, attempt: 10, ceiling: 2 * time.Second},
+		{name: "shift overflow capped", backoff: Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}, attempt: 62, ceiling: 2 * time.Second},
+		{name: "large attempt capped", backoff: Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}, attempt: 1000, ceiling: 2 * time.Second},
+		{name: "no delay", backoff: Backoff{}, attempt: 2, ceiling: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := test.backoff.Delay(test.attempt); got < 0 || got > test.ceiling {
+					t.Fatalf("Delay(%d) = %v, want between 0 and %v", test.attempt, got, test.ceiling)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen Returned instead of calling a dependency known to be down
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states, as reported by State
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Outcome Result of a call let through by the breaker
+type Outcome int
+
+const (
+	// Success The dependency answered, even with an error of the caller's making
+	Success Outcome = iota
+	// Failure The dependency failed with a transient error or timed out
+	Failure
+	// Ignored The call tells nothing about the dependency, e.g. it was cancelled by the client
+	Ignored
+)
+
+// Breaker Fail fast once a dependency failed Threshold times in a row, for Cooldown. Then a single call is let through
+// as a probe: its success closes the breaker, its failure opens it again. A zero Threshold disables the breaker
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// Allow Report whether a call can go through, ErrCircuitOpen if not. Every allowed call must be followed by Record
+func (breaker *Breaker) Allow() error {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.Threshold <= 0 || !breaker.open {
+		return nil
+	}
+	if breaker.probing || time.Since(breaker.openedAt) < breaker.Cooldown {
+		return ErrCircuitOpen
+	}
+	breaker.probing = true
+	return nil
+}
+
+// Record Account for the outcome of an allowed call
+func (breaker *Breaker) Record(outcome Outcome) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.Threshold <= 0 {
+		return
+	}
+	wasProbe := breaker.probing
+	breaker.probing = false
+	switch outcome {
+	case Success:
+		breaker.failures = 0
+		breaker.open = false
+	case Failure:
+		breaker.failures++
+		if wasProbe || breaker.failures >= breaker.Threshold {
+			breaker.open = true
+			breaker.openedAt = time.Now()
+		}
+	}
+}
+
+// State Get the current state of the breaker
+func (breaker *Breaker) State() string {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch {
+	case !breaker.open:
+		return StateClosed
+	case breaker.probing || time.Since(breaker.openedAt) >= breaker.Cooldown:
+		return StateHalfOpen
+	default:
+		return StateOpen
+	}
+}
@@ -0,0 +1,135 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// step A call through the breaker: whether Allow lets it through and, if so, the outcome recorded
+type step struct {
+	allowed   bool
+	outcome   Outcome
+	wantState string
+}
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+		steps     []step
+	}{
+		{
+			name:      "opens after threshold failures in a row",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateOpen},
+				{allowed: false, wantState: StateOpen},
+			},
+		},
+		{
+			name:      "success resets the failures",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Success, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+			},
+		},
+		{
+			name:      "ignored calls do not count",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Ignored, wantState: StateClosed},
+				{allowed: true, outcome: Ignored, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateOpen},
+			},
+		},
+		{
+			name:      "successful probe closes it",
+			threshold: 1,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateHalfOpen},
+				{allowed: true, outcome: Success, wantState: StateClosed},
+				{allowed: true, outcome: Success, wantState: StateClosed},
+			},
+		},
+		{
+			name:      "failed probe opens it again",
+			threshold: 3,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateHalfOpen},
+				// A single failure of the probe is enough
+				{allowed: true, outcome: Failure, wantState: StateHalfOpen},
+				{allowed: true, outcome: Success, wantState: StateClosed},
+			},
+		},
+		{
+			name:      "ignored probe lets another one through",
+			threshold: 1,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateHalfOpen},
+				{allowed: true, outcome: Ignored, wantState: StateHalfOpen},
+				{allowed: true, outcome: Success, wantState: StateClosed},
+			},
+		},
+		{
+			name:      "zero threshold disables it",
+			threshold: 0,
+			steps: []step{
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+				{allowed: true, outcome: Failure, wantState: StateClosed},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := &Breaker{Threshold: test.threshold, Cooldown: test.cooldown}
+			for i, s := range test.steps {
+				err := breaker.Allow()
+				if allowed := err == nil; allowed != s.allowed {
+					t.Fatalf("step %d: Allow() = %v, want allowed %v", i+1, err, s.allowed)
+				}
+				if err != nil && !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("step %d: Allow() = %v, want ErrCircuitOpen", i+1, err)
+				}
+				if s.allowed {
+					breaker.Record(s.outcome)
+				}
+				if got := breaker.State(); got != s.wantState {
+					t.Fatalf("step %d: State() = %q, want %q", i+1, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+// TestBreakerSingleProbe Once the cooldown is over, only one call goes through until the probe is recorded
+func TestBreakerSingleProbe(t *testing.T) {
+	breaker := &Breaker{Threshold: 1}
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Allow() = %v, want nil", err)
+	}
+	breaker.Record(Failure)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe Allow() = %v, want nil", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Allow() during the probe = %v, want ErrCircuitOpen", err)
+		}
+	}
+	if got := breaker.State(); got != StateHalfOpen {
+		t.Errorf("State() during the probe = %q, want %q", got, StateHalfOpen)
+	}
+}
@@ -0,0 +1,86 @@
+package resilience
+
+import (
+	"database/sql/driver"
+	"errors"
+	mssql "github.com/microsoft/go-mssqldb"
+	"io"
+	"net"
+)
+
+// Transience Whether an error is transient and, if so, whether the failed statement may have been applied
+type Transience int
+
+const (
+	// Permanent Errors that a retry would meet again, e.g. constraint violations or invalid credentials
+	Permanent Transience = iota
+	// Rejected Transient errors met before the statement was applied, any operation can be retried
+	Rejected
+	// Interrupted Transient errors met while the statement ran, only idempotent operations can be retried
+	Interrupted
+)
+
+// rejectedErrors SQL Server and Azure SQL error numbers of requests refused or rolled back as a whole
+var rejectedErrors = map[int32]bool{
+	1205:  true, // Deadlock victim, the transaction was rolled back
+	4060:  true, // Cannot open the database
+	4221:  true, // Login to a read secondary failed during a replica change
+	10928: true, // Resource limit reached
+	10929: true, // Resource limit reached, minimum guarantee not met
+	10936: true, // Request limit reached for the elastic pool
+	40501: true, // Service busy
+	40613: true, // Database unavailable, e.g. during a failover
+	41301: true, // Dependency failure of an In-Memory OLTP transaction
+	41302: true, // Update conflict of an In-Memory OLTP transaction
+	41305: true, // Repeatable read validation failure
+	41325: true, // Serializable validation failure
+	42108: true, // Serverless database resuming
+	42109: true, // Serverless database paused
+	49918: true, // Not enough resources to process the request
+	49919: true, // Too many create or update operations in progress
+	49920: true, // Too many operations in progress
+}
+
+// interruptedErrors SQL Server and Azure SQL error numbers of connections lost while processing a request
+var interruptedErrors = map[int32]bool{
+	20:    true, // Instance does not support encryption, seen on dropped connections
+	64:    true, // Connection lost
+	121:   true, // Semaphore timeout on the transport
+	233:   true, // No process on the other end of the pipe
+	10053: true, // Connection aborted by the host
+	10054: true, // Connection reset by the peer
+	10060: true, // Connection attempt timed out
+	40197: true, // Error processing the request, e.g. during an upgrade or a failover
+}
+
+// Classify Tell whether an error returned by the SQL Server driver is transient
+func Classify(err error) Transience {
+	if err == nil {
+		return Permanent
+	}
+	// The driver reports broken connections found before sending the query with driver.ErrBadConn
+	if errors.Is(err, driver.ErrBadConn) {
+		return Rejected
+	}
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		switch {
+		case rejectedErrors[sqlErr.Number]:
+			return Rejected
+		case interruptedErrors[sqlErr.Number]:
+			return Interrupted
+		}
+		return Permanent
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if opErr.Op == "dial" {
+			return Rejected
+		}
+		return Interrupted
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Interrupted
+	}
+	return Permanent
+}
@@ -0,0 +1,152 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertReloader Serve a certificate and key pair, reloaded when either file changes on disk so renewed certificates
+// are picked up without restarting the server
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewCertReloader Load the certificate and key pair, failing if it is invalid
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate Get the current certificate, to be used as tls.Config.GetCertificate
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+	return reloader.cert, nil
+}
+
+// Run Check the files every interval and reload them once changed, until ctx is done.
+// An invalid pair, e.g. read while only one of the files was replaced, is logged and the current certificate is kept
+func (reloader *CertReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTimes, err := reloader.stat()
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to check the TLS certificate", "error", err)
+			continue
+		}
+		reloader.mu.RLock()
+		changed := modTimes != reloader.modTimes
+		reloader.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err = reloader.reload(); err != nil {
+			slog.WarnContext(ctx, "Failed to reload the TLS certificate", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "TLS certificate reloaded", "cert_file", reloader.certFile)
+	}
+}
+
+func (reloader *CertReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (reloader *CertReloader) reload() error {
+	modTimes, err := reloader.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	reloader.cert = &cert
+	reloader.modTimes = modTimes
+	return nil
+}
+
+// NewServerConfig Build the TLS configuration of the server. When clientCAFile is set, clients may present a certificate
+// signed by one of its CAs, which the ClientCertMiddleware then requires on the write endpoints
+func NewServerConfig(reloader *CertReloader, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no PEM certificate found in " + clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// RedirectHandler Redirect plain HTTP requests to the same URL on the HTTPS listener at httpsAddr.
+// GET and HEAD are redirected permanently, the other methods with 308 so clients replay them unchanged
+func RedirectHandler(httpsAddr string) (http.Handler, error) {
+	_, port, err := net.SplitHostPort(httpsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTPS address %q: %v", httpsAddr, err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target, status)
+	}), nil
+}
@@ -0,0 +1,23 @@
+package validators
+
+import (
+	"openprogramschedule/internal/models"
+	"time"
+)
+
+func ValidateApiKey(apiKey *models.ApiKey) error {
+	f := newFields("api_key")
+
+	f.text("name", apiKey.Name)
+	f.list("scopes", apiKey.Scopes)
+	f.optionalText("expires_at", apiKey.ExpiresAt)
+
+	// Api key expiry must be in the future
+	if apiKey.ExpiresAt != nil {
+		if expiresAt, err := time.Parse(time.RFC3339, *apiKey.ExpiresAt); err == nil && !expiresAt.After(time.Now()) {
+			f.add("expires_at", "not_in_future", "must be in the future")
+		}
+	}
+
+	return f.err()
+}
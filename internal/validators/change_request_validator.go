@@ -0,0 +1,44 @@
+package validators
+
+import (
+	"openprogramschedule/internal/models"
+)
+
+func ValidateChangeRequest(changeRequest *models.ChangeRequest) error {
+	f := newFields("change_request")
+
+	// Change request action validation, add and update carry a schedule, update and delete a schedule_id
+	f.text("action", changeRequest.Action)
+	needsSchedule := changeRequest.Action == models.ChangeActionAdd || changeRequest.Action == models.ChangeActionUpdate
+	needsScheduleID := changeRequest.Action == models.ChangeActionUpdate || changeRequest.Action == models.ChangeActionDelete
+	if needsScheduleID && changeRequest.ScheduleId == nil {
+		f.add("schedule_id", "required", "is required on %s change requests", changeRequest.Action)
+	}
+	if needsSchedule && changeRequest.Schedule == nil {
+		f.add("schedule", "required", "is required on %s change requests", changeRequest.Action)
+	}
+	if changeRequest.Action == models.ChangeActionDelete && changeRequest.Schedule != nil {
+		f.add("schedule", "not_allowed", "must be missing on delete change requests")
+	}
+
+	if changeRequest.Schedule != nil {
+		validateSchedule(f.nested("schedule", "schedule"), changeRequest.Schedule)
+	}
+
+	f.text("comment", changeRequest.Comment)
+	f.text("submitted_by", changeRequest.SubmittedBy)
+
+	return f.err()
+}
+
+func ValidateChangeReview(review *models.ChangeReview, commentRequired bool) error {
+	f := newFields("change_review")
+
+	f.text("reviewed_by", review.ReviewedBy)
+	if commentRequired && review.Comment == "" {
+		f.add("comment", "required", "is required when rejecting")
+	}
+	f.text("comment", review.Comment)
+
+	return f.err()
+}
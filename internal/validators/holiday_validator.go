@@ -0,0 +1,30 @@
+package validators
+
+import (
+	"fmt"
+	"openprogramschedule/internal/models"
+)
+
+func ValidateHoliday(holiday *models.Holiday) error {
+	f := newFields("holiday")
+
+	f.text("name", holiday.Name)
+	f.text("date", holiday.Date)
+	f.text("country", holiday.Country)
+	f.optionalText("region", holiday.Region)
+	if holiday.LineupDay != nil {
+		f.number("lineup_day", *holiday.LineupDay, true)
+	}
+
+	// Holiday substitutions validation
+	for i, substitution := range holiday.Substitutions {
+		s := f.nested(fmt.Sprintf("substitutions[%d]", i), "holiday_substitution")
+		s.number("from_program_id", int(substitution.FromProgramId), substitution.FromProgramId != 0)
+		s.number("to_program_id", int(substitution.ToProgramId), substitution.ToProgramId != 0)
+		if substitution.FromProgramId != 0 && substitution.FromProgramId == substitution.ToProgramId {
+			s.add("to_program_id", "same_program", "must be a different program than from_program_id")
+		}
+	}
+
+	return f.err()
+}
@@ -0,0 +1,233 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats of the text fields holding dates
+const (
+	FormatDate     = "date"      // YYYY-MM-DD
+	FormatDateTime = "date-time" // RFC 3339
+)
+
+// Rule Constraints on a field. Lengths are counted in characters, not bytes, Minimum and Maximum bound numbers
+type Rule struct {
+	Required  bool     `json:"required"`
+	MinLength int      `json:"min_length,omitempty"`
+	MaxLength int      `json:"max_length,omitempty"`
+	Minimum   int      `json:"minimum,omitempty"`
+	Maximum   int      `json:"maximum,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	// Pattern Regular expression the whole value must match
+	Pattern string `json:"pattern,omitempty"`
+	pattern *regexp.Regexp
+}
+
+// defaultRules Constraints on the fields of each model, keyed by model and JSON field, unless configured otherwise
+var defaultRules = map[string]map[string]Rule{
+	"program": {
+		"name":          {Required: true, MinLength: 3, MaxLength: 52},
+		"description":   {Required: true, MinLength: 3, MaxLength: 100},
+		"host":          {Required: true, MinLength: 3, MaxLength: 52},
+		"category":      {Required: true, MinLength: 3, MaxLength: 52},
+		"in_production": {Required: true},
+		"publish_at":    {Format: FormatDateTime},
+	},
+	"schedule": {
+		"program_id":  {Required: true, Minimum: 1},
+		"description": {Required: true, MinLength: 3, MaxLength: 100},
+		"day":         {Required: true, Values: models.DaysOfTheWeek},
+		"date":        {Required: true, Format: FormatDateTime},
+		"status":      {Values: []string{models.ScheduleStatusDraft, models.ScheduleStatusPublished}},
+		"publish_at":  {Format: FormatDateTime},
+	},
+	// schedule_override Rules of the overrides on top of the schedule ones
+	"schedule_override": {
+		"end_date":        {Required: true, Format: FormatDateTime},
+		"override_reason": {Required: true, MinLength: 3, MaxLength: 255},
+	},
+	"holiday": {
+		"name":       {Required: true, MinLength: 3, MaxLength: 100},
+		"date":       {Required: true, Format: FormatDate},
+		"country":    {Required: true, MinLength: 2, MaxLength: 2},
+		"region":     {MinLength: 1, MaxLength: 100},
+		"lineup_day": {Minimum: 1, Maximum: 7},
+	},
+	"holiday_substitution": {
+		"from_program_id": {Required: true, Minimum: 1},
+		"to_program_id":   {Required: true, Minimum: 1},
+	},
+	"change_request": {
+		"action":       {Required: true, Values: []string{models.ChangeActionAdd, models.ChangeActionUpdate, models.ChangeActionDelete}},
+		"comment":      {MaxLength: 500},
+		"submitted_by": {Required: true, MaxLength: 100},
+	},
+	"change_review": {
+		"reviewed_by": {Required: true, MaxLength: 100},
+		"comment":     {MaxLength: 500},
+	},
+	"api_key": {
+		"name":       {Required: true, MinLength: 3, MaxLength: 100},
+		"scopes":     {Required: true, Values: models.Scopes},
+		"expires_at": {Format: FormatDateTime},
+	},
+}
+
+// fields Collects the errors of the fields of a model, checked against its rules. Nested models share the errors of their parent
+type fields struct {
+	rules  map[string]Rule
+	prefix string
+	errs   *[]apperrors.FieldError
+}
+
+func newFields(model string) fields {
+	return fields{rules: active.Rules[model], errs: &[]apperrors.FieldError{}}
+}
+
+// nested Get the collector of a model nested in the current one at path, e.g. substitutions[0]. An empty path checks
+// the current object against the rules of another model
+func (f fields) nested(path string, model string) fields {
+	return fields{rules: active.Rules[model], prefix: f.path(path), errs: f.errs}
+}
+
+// path Get the JSON path of a field of the current model
+func (f fields) path(field string) string {
+	switch {
+	case field == "":
+		return f.prefix
+	case f.prefix == "":
+		return field
+	default:
+		return f.prefix + "." + field
+	}
+}
+
+// add Record an error of a field, the message is prefixed with the path of the field
+func (f fields) add(field string, code string, format string, args ...any) {
+	path := f.path(field)
+	*f.errs = append(*f.errs, apperrors.FieldError{Field: path, Code: code, Message: path + " " + fmt.Sprintf(format, args...)})
+}
+
+// text Check a text field. Empty fields are only checked for presence
+func (f fields) text(field string, value string) {
+	rule := f.rules[field]
+	if value == "" {
+		if rule.Required {
+			f.add(field, "required", "is required")
+		}
+		return
+	}
+
+	length := utf8.RuneCountInString(value)
+	if rule.MinLength > 0 && length < rule.MinLength {
+		f.add(field, "too_short", "must be at least %d characters", rule.MinLength)
+	}
+	if rule.MaxLength > 0 && length > rule.MaxLength {
+		f.add(field, "too_long", "must be at most %d characters", rule.MaxLength)
+	}
+	switch rule.Format {
+	case FormatDate:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			f.add(field, "invalid_format", "must be formatted as YYYY-MM-DD")
+		}
+	case FormatDateTime:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			f.add(field, "invalid_format", "must be in RFC 3339 format")
+		}
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(value) {
+		f.add(field, "pattern_mismatch", "must match %s", rule.Pattern)
+	}
+	if len(rule.Values) > 0 && !slices.Contains(rule.Values, value) {
+		f.add(field, "not_allowed", "must be one of %s", strings.Join(rule.Values, ", "))
+	}
+}
+
+// optionalText Check a text field which may be missing, an empty value is invalid when present
+func (f fields) optionalText(field string, value *string) {
+	if value == nil {
+		if f.rules[field].Required {
+			f.add(field, "required", "is required")
+		}
+		return
+	}
+	if *value == "" {
+		f.add(field, "too_short", "must not be empty")
+		return
+	}
+	f.text(field, *value)
+}
+
+// number Check a number field, present tells whether it was sent
+func (f fields) number(field string, value int, present bool) {
+	rule := f.rules[field]
+	if !present {
+		if rule.Required {
+			f.add(field, "required", "is required")
+		}
+		return
+	}
+	if rule.Minimum != 0 && value < rule.Minimum {
+		f.add(field, "too_small", "must be at least %d", rule.Minimum)
+	}
+	if rule.Maximum != 0 && value > rule.Maximum {
+		f.add(field, "too_large", "must be at most %d", rule.Maximum)
+	}
+}
+
+// list Check a list of values, each of them must be allowed by the rule
+func (f fields) list(field string, values []string) {
+	rule := f.rules[field]
+	if len(values) == 0 {
+		if rule.Required {
+			f.add(field, "required", "is required")
+		}
+		return
+	}
+	for i, value := range values {
+		if len(rule.Values) > 0 && !slices.Contains(rule.Values, value) {
+			f.add(fmt.Sprintf("%s[%d]", field, i), "not_allowed", "must be one of %s", strings.Join(rule.Values, ", "))
+		}
+	}
+}
+
+// timestamp Check a time field, missing when nil or zero. Malformed and impossible dates are reported with the reason
+// they failed to parse, if known
+func (f fields) timestamp(field string, value *models.Timestamp) {
+	if value == nil || (value.IsZero() && value.ParseError() == nil) {
+		f.present(field, false)
+		return
+	}
+	if err := value.ParseError(); err != nil {
+		reason := ""
+		var parseErr *time.ParseError
+		if errors.As(err, &parseErr) {
+			reason = parseErr.Message
+		}
+		f.add(field, "invalid_format", "must be a valid RFC 3339 date and time with an offset, e.g. 2024-12-06T12:00:00Z%s", reason)
+	}
+}
+
+// present Check that a field without a value to check is set when required
+func (f fields) present(field string, set bool) {
+	if !set && f.rules[field].Required {
+		f.add(field, "required", "is required")
+	}
+}
+
+// err Get the error reporting every collected field error, nil when there is none
+func (f fields) err() error {
+	if len(*f.errs) == 0 {
+		return nil
+	}
+	return apperrors.Invalid(*f.errs)
+}
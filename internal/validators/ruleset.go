@@ -0,0 +1,154 @@
+package validators
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// Custom checks a deployment may enable on top of the field rules
+const (
+	CheckScheduleProgramInProduction = "schedule_program_in_production"
+	CheckScheduleDayMatchesDate      = "schedule_day_matches_date"
+)
+
+// Checks Description of each custom check
+var Checks = map[string]string{
+	CheckScheduleProgramInProduction: "schedules, overrides included, can only be added for programs in production",
+	CheckScheduleDayMatchesDate:      "the day of a schedule must be the day of the week of its date",
+}
+
+// fixedRules Fields whose rules the server relies on, e.g. the day names matched by the lineup queries
+var fixedRules = map[string][]string{
+	"schedule":       {"day", "status"},
+	"change_request": {"action"},
+	"api_key":        {"scopes"},
+}
+
+// requiredFields Fields the database needs, which stay required whatever the configuration
+var requiredFields = map[string][]string{
+	"program":              {"name", "in_production"},
+	"schedule":             {"program_id", "day", "date"},
+	"schedule_override":    {"end_date"},
+	"holiday":              {"date", "country"},
+	"holiday_substitution": {"from_program_id", "to_program_id"},
+	"api_key":              {"name"},
+}
+
+// RuleSet Rules of each model along with the custom checks enabled by the deployment
+type RuleSet struct {
+	Rules  map[string]map[string]Rule `json:"rules"`
+	Checks []string                   `json:"checks"`
+}
+
+// active Set once at startup, before any request
+var active = RuleSet{Rules: defaultRules, Checks: []string{}}
+
+// NewRuleSet Get the default rules with the configured ones, JSON Rule objects, merged over the rules of the same fields,
+// and the given checks enabled. The members a configured rule sets replace the default ones, the others are kept.
+// Unknown models, fields, members and checks, invalid patterns and changes to the rules the server relies on are errors
+func NewRuleSet(rules map[string]map[string]json.RawMessage, checks []string) (RuleSet, error) {
+	ruleSet := RuleSet{Rules: make(map[string]map[string]Rule, len(defaultRules)), Checks: []string{}}
+	for model, fields := range defaultRules {
+		ruleSet.Rules[model] = make(map[string]Rule, len(fields))
+		for field, rule := range fields {
+			ruleSet.Rules[model][field] = rule
+		}
+	}
+
+	var errs []error
+	models := make([]string, 0, len(rules))
+	for model := range rules {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		if _, exists := defaultRules[model]; !exists {
+			errs = append(errs, fmt.Errorf("unknown model %q", model))
+			continue
+		}
+		fields := make([]string, 0, len(rules[model]))
+		for field := range rules[model] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			rule, err := checkRule(model, field, rules[model][field])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s.%s: %w", model, field, err))
+				continue
+			}
+			ruleSet.Rules[model][field] = rule
+		}
+	}
+
+	for _, check := range checks {
+		if _, exists := Checks[check]; !exists {
+			errs = append(errs, fmt.Errorf("unknown check %q", check))
+			continue
+		}
+		if !slices.Contains(ruleSet.Checks, check) {
+			ruleSet.Checks = append(ruleSet.Checks, check)
+		}
+	}
+	return ruleSet, errors.Join(errs...)
+}
+
+// checkRule Merge a configured rule over the default one of its field and check the result, compiling its pattern
+func checkRule(model string, field string, configured json.RawMessage) (Rule, error) {
+	defaultRule, exists := defaultRules[model][field]
+	if !exists {
+		return defaultRule, errors.New("unknown field")
+	}
+	rule := defaultRule
+	rule.Values = slices.Clone(defaultRule.Values)
+	decoder := json.NewDecoder(bytes.NewReader(configured))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		return rule, fmt.Errorf("invalid rule: %v", err)
+	}
+
+	switch {
+	case slices.Contains(fixedRules[model], field):
+		return rule, errors.New("rule cannot be configured")
+	case !rule.Required && slices.Contains(requiredFields[model], field):
+		return rule, errors.New("field must stay required")
+	case rule.Format != defaultRule.Format:
+		return rule, fmt.Errorf("format cannot be changed from %q", defaultRule.Format)
+	case rule.MinLength < 0 || rule.MaxLength < 0:
+		return rule, errors.New("lengths must not be negative")
+	case rule.MaxLength > 0 && rule.MinLength > rule.MaxLength:
+		return rule, errors.New("min_length must not exceed max_length")
+	case rule.Maximum != 0 && rule.Minimum > rule.Maximum:
+		return rule, errors.New("minimum must not exceed maximum")
+	}
+
+	if rule.Pattern != "" {
+		// The pattern applies to the whole value
+		pattern, err := regexp.Compile(`^(?:` + rule.Pattern + `)$`)
+		if err != nil {
+			return rule, fmt.Errorf("invalid pattern: %v", err)
+		}
+		rule.pattern = pattern
+	}
+	return rule, nil
+}
+
+// SetRules Set the rules of the validators, to be called before serving requests
+func SetRules(ruleSet RuleSet) {
+	active = ruleSet
+}
+
+// ActiveRules Get the rules of the validators, served to clients so they can mirror them
+func ActiveRules() RuleSet {
+	return active
+}
+
+// Enabled Report whether a custom check is enabled
+func Enabled(check string) bool {
+	return slices.Contains(active.Checks, check)
+}
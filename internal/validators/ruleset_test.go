@@ -0,0 +1,201 @@
+package validators
+
+import (
+	"encoding/json"
+	"errors"
+	"openprogramschedule/internal/apperrors"
+	"openprogramschedule/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestNewRuleSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]map[string]json.RawMessage
+		// err Substring of the error, none expected when empty
+		err   string
+		check func(t *testing.T, ruleSet RuleSet)
+	}{
+		{
+			name:  "defaults without configuration",
+			rules: nil,
+			check: func(t *testing.T, ruleSet RuleSet) {
+				if got := ruleSet.Rules["program"]["name"]; got.MinLength != 3 || got.MaxLength != 52 || !got.Required {
+					t.Errorf("program.name = %+v, want the default rule", got)
+				}
+			},
+		},
+		{
+			name:  "members set replace the default ones, the others are kept",
+			rules: map[string]map[string]json.RawMessage{"program": {"name": json.RawMessage(`{"max_length": 80}`)}},
+			check: func(t *testing.T, ruleSet RuleSet) {
+				if got := ruleSet.Rules["program"]["name"]; got.MinLength != 3 || got.MaxLength != 80 || !got.Required {
+					t.Errorf("program.name = %+v, want min_length 3, max_length 80 and required", got)
+				}
+			},
+		},
+		{
+			name:  "required field made optional",
+			rules: map[string]map[string]json.RawMessage{"program": {"description": json.RawMessage(`{"required": false}`)}},
+			check: func(t *testing.T, ruleSet RuleSet) {
+				if ruleSet.Rules["program"]["description"].Required {
+					t.Error("program.description is required, want optional")
+				}
+			},
+		},
+		{
+			name:  "pattern compiled",
+			rules: map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"pattern": "[a-z]+"}`)}},
+			check: func(t *testing.T, ruleSet RuleSet) {
+				if ruleSet.Rules["program"]["host"].pattern == nil {
+					t.Error("program.host pattern not compiled")
+				}
+			},
+		},
+		{
+			name:  "unknown model",
+			rules: map[string]map[string]json.RawMessage{"episode": {"name": json.RawMessage(`{}`)}},
+			err:   `unknown model "episode"`,
+		},
+		{
+			name:  "unknown field",
+			rules: map[string]map[string]json.RawMessage{"program": {"rating": json.RawMessage(`{}`)}},
+			err:   "program.rating: unknown field",
+		},
+		{
+			name:  "unknown member",
+			rules: map[string]map[string]json.RawMessage{"program": {"name": json.RawMessage(`{"max": 10}`)}},
+			err:   "program.name: invalid rule",
+		},
+		{
+			name:  "fixed rule",
+			rules: map[string]map[string]json.RawMessage{"schedule": {"day": json.RawMessage(`{"values": ["Monday"]}`)}},
+			err:   "schedule.day: rule cannot be configured",
+		},
+		{
+			name:  "fixed rule even when unchanged",
+			rules: map[string]map[string]json.RawMessage{"api_key": {"scopes": json.RawMessage(`{}`)}},
+			err:   "api_key.scopes: rule cannot be configured",
+		},
+		{
+			name:  "field needed by the database made optional",
+			rules: map[string]map[string]json.RawMessage{"schedule": {"program_id": json.RawMessage(`{"required": false}`)}},
+			err:   "schedule.program_id: field must stay required",
+		},
+		{
+			name:  "override end date made optional",
+			rules: map[string]map[string]json.RawMessage{"schedule_override": {"end_date": json.RawMessage(`{"required": false}`)}},
+			err:   "schedule_override.end_date: field must stay required",
+		},
+		{
+			name:  "format changed",
+			rules: map[string]map[string]json.RawMessage{"holiday": {"date": json.RawMessage(`{"format": "date-time"}`)}},
+			err:   `holiday.date: format cannot be changed from "date"`,
+		},
+		{
+			name:  "format added",
+			rules: map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"format": "date"}`)}},
+			err:   `program.host: format cannot be changed from ""`,
+		},
+		{
+			name:  "negative length",
+			rules: map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"min_length": -1}`)}},
+			err:   "program.host: lengths must not be negative",
+		},
+		{
+			name:  "min_length over max_length",
+			rules: map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"min_length": 60}`)}},
+			err:   "program.host: min_length must not exceed max_length",
+		},
+		{
+			name:  "minimum over maximum",
+			rules: map[string]map[string]json.RawMessage{"holiday": {"lineup_day": json.RawMessage(`{"minimum": 8}`)}},
+			err:   "holiday.lineup_day: minimum must not exceed maximum",
+		},
+		{
+			name:  "invalid pattern",
+			rules: map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"pattern": "[a-z"}`)}},
+			err:   "program.host: invalid pattern",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ruleSet, err := NewRuleSet(test.rules, nil)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("NewRuleSet() error = %v, want none", err)
+				}
+				test.check(t, ruleSet)
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("NewRuleSet() error = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNewRuleSetReportsEveryError(t *testing.T) {
+	_, err := NewRuleSet(map[string]map[string]json.RawMessage{
+		"program":  {"rating": json.RawMessage(`{}`)},
+		"schedule": {"status": json.RawMessage(`{}`)},
+	}, []string{"unknown_check"})
+	for _, want := range []string{"program.rating", "schedule.status", `unknown check "unknown_check"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("NewRuleSet() error = %v, want one containing %q", err, want)
+		}
+	}
+}
+
+func TestNewRuleSetChecks(t *testing.T) {
+	ruleSet, err := NewRuleSet(nil, []string{CheckScheduleDayMatchesDate, CheckScheduleDayMatchesDate})
+	if err != nil {
+		t.Fatalf("NewRuleSet() error = %v, want none", err)
+	}
+	if len(ruleSet.Checks) != 1 || ruleSet.Checks[0] != CheckScheduleDayMatchesDate {
+		t.Errorf("Checks = %v, want [%s]", ruleSet.Checks, CheckScheduleDayMatchesDate)
+	}
+}
+
+// TestNewRuleSetKeepsDefaults Configured rules must not leak into the defaults shared by every rule set
+func TestNewRuleSetKeepsDefaults(t *testing.T) {
+	if _, err := NewRuleSet(map[string]map[string]json.RawMessage{"program": {"name": json.RawMessage(`{"max_length": 80}`)}}, nil); err != nil {
+		t.Fatalf("NewRuleSet() error = %v, want none", err)
+	}
+	if got := defaultRules["program"]["name"].MaxLength; got != 52 {
+		t.Errorf("default program.name max_length = %d, want 52", got)
+	}
+}
+
+func TestConfiguredPattern(t *testing.T) {
+	ruleSet, err := NewRuleSet(map[string]map[string]json.RawMessage{"program": {"host": json.RawMessage(`{"pattern": "[a-z]+"}`)}}, nil)
+	if err != nil {
+		t.Fatalf("NewRuleSet() error = %v, want none", err)
+	}
+	SetRules(ruleSet)
+	t.Cleanup(func() { SetRules(RuleSet{Rules: defaultRules, Checks: []string{}}) })
+
+	inProduction := true
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "lowercase"},
+		// The pattern must match the whole value, not a part of it
+		{host: "Mixed case", want: "pattern_mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			err := ValidateProgram(&models.Program{Name: "News", Description: "Daily news", Host: test.host, Category: "News", InProduction: &inProduction})
+			var appErr *apperrors.Error
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("ValidateProgram() error = %v, want none", err)
+			case test.want != "" && (!errors.As(err, &appErr) || len(appErr.Fields) != 1 || appErr.Fields[0].Code != test.want):
+				t.Errorf("ValidateProgram() error = %v, want a single %s field error", err, test.want)
+			}
+		})
+	}
+}
@@ -1,22 +1,68 @@
 package validators
 
 import (
-	"errors"
+	"fmt"
+	"openprogramschedule/internal/apperrors"
 	"openprogramschedule/internal/models"
+	"slices"
 )
 
 func ValidateSchedule(schedule *models.Schedule) error {
+	f := newFields("schedule")
+	validateSchedule(f, schedule)
+	return f.err()
+}
+
+// validateSchedule Check the fields shared by schedules, overrides and the schedules of change requests
+func validateSchedule(f fields, schedule *models.Schedule) {
+	f.number("program_id", int(schedule.ProgramId), schedule.ProgramId != 0)
+	f.text("description", schedule.Description)
+	f.text("day", schedule.Day)
+	f.timestamp("date", &schedule.Date)
+	// New schedules start as draft unless published right away
+	f.text("status", schedule.Status)
+	f.timestamp("publish_at", schedule.PublishAt)
+
+	if Enabled(CheckScheduleDayMatchesDate) && slices.Contains(models.DaysOfTheWeek, schedule.Day) && !schedule.Date.IsZero() {
+		// Weekdays start on Sunday, the days of the schedules on Monday
+		day := models.DaysOfTheWeek[(int(schedule.Date.Weekday())+6)%7]
+		if schedule.Day != day {
+			f.add("day", "date_mismatch", "must be %s, the day of the week of date", day)
+		}
+	}
+}
+
+// scheduleStatusTransitions Allowed status changes for each schedule status
+var scheduleStatusTransitions = map[string][]string{
+	models.ScheduleStatusDraft:     {models.ScheduleStatusPublished, models.ScheduleStatusCancelled},
+	models.ScheduleStatusPublished: {models.ScheduleStatusAired, models.ScheduleStatusCancelled},
+	models.ScheduleStatusCancelled: {},
+	models.ScheduleStatusAired:     {},
+}
 
-	// Schedule description validation
-	if len(schedule.Description) == 0 {
-		return errors.New("invalid input: schedule description is missing")
+// ValidateScheduleStatusTransition Check a status change: unknown statuses are invalid, moves the current status does not
+// allow are conflicts
+func ValidateScheduleStatusTransition(from string, to string) error {
+	if _, exists := scheduleStatusTransitions[to]; !exists {
+		return apperrors.Validation("invalid_status", fmt.Sprintf("Unknown schedule status %q", to))
 	}
-	if len(schedule.Description) < 3 {
-		return errors.New("invalid input: schedule description must be at least 3 characters")
+	if !slices.Contains(scheduleStatusTransitions[from], to) {
+		return apperrors.Conflict("invalid_status_transition", fmt.Sprintf("Schedule cannot move from %s to %s", from, to))
 	}
-	if len(schedule.Description) > 100 {
-		return errors.New("invalid input: schedule description must be less than 100 characters")
+	return nil
+}
+
+func ValidateScheduleOverride(schedule *models.Schedule) error {
+	f := newFields("schedule")
+	validateSchedule(f, schedule)
+
+	// Override reason and window validation
+	o := f.nested("", "schedule_override")
+	o.optionalText("override_reason", schedule.OverrideReason)
+	o.timestamp("end_date", schedule.EndDate)
+	if schedule.EndDate != nil && schedule.EndDate.ParseError() == nil && !schedule.Date.IsZero() && !schedule.EndDate.After(schedule.Date.Time) {
+		o.add("end_date", "before_start", "must be after date")
 	}
 
-	return nil
+	return f.err()
 }
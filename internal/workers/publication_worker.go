@@ -0,0 +1,122 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"openprogramschedule/internal/events"
+	"openprogramschedule/internal/repository"
+	"openprogramschedule/internal/resilience"
+	"sync"
+	"time"
+)
+
+// Bounds of the wait between two checks: at most maxPublicationWait, so programs and schedules embargoed after the last
+// check are not missed, and at least minPublicationWait, so a publish_at the release keeps missing does not spin
+const (
+	maxPublicationWait = 30 * time.Second
+	minPublicationWait = time.Second
+)
+
+// publicationBackoff Extra wait after consecutive failed runs, so a failing release does not hammer the database
+var publicationBackoff = resilience.Backoff{BaseDelay: 2 * time.Second, MaxDelay: maxPublicationWait}
+
+// PublicationWorker Lift the embargo of programs and schedules once their publish_at has passed and emit an event for each
+type PublicationWorker struct {
+	Db     *sql.DB
+	Broker *events.Broker
+
+	mu        sync.Mutex
+	running   bool
+	lastRun   time.Time
+	lastError error
+}
+
+// WorkerStatus State of a background worker as reported by the readiness check
+type WorkerStatus struct {
+	Running bool       `json:"running"`
+	Healthy bool       `json:"healthy"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+}
+
+// Status Report whether the worker is running and its last run, recent enough, met no error. Errors are logged, not reported
+func (worker *PublicationWorker) Status() WorkerStatus {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	status := WorkerStatus{Running: worker.running}
+	if !worker.lastRun.IsZero() {
+		lastRun := worker.lastRun
+		status.LastRun = &lastRun
+	}
+	status.Healthy = worker.running && worker.lastError == nil && time.Since(worker.lastRun) < 2*maxPublicationWait
+	return status
+}
+
+// Run Release the due programs and schedules, then sleep until the next publish_at, until ctx is done
+func (worker *PublicationWorker) Run(ctx context.Context) {
+	worker.setRunning(true)
+	defer worker.setRunning(false)
+	failures := 0
+	for {
+		err := worker.release(ctx)
+
+		wait := maxPublicationWait
+		next, nextErr := repository.GetNextPublication(ctx, worker.Db)
+		if nextErr != nil {
+			slog.ErrorContext(ctx, "Error while getting the next publication", "error", nextErr)
+			err = nextErr
+		} else if next != nil && time.Until(*next) < wait {
+			wait = time.Until(*next)
+		}
+		wait = max(wait, minPublicationWait)
+		if err != nil {
+			wait = min(max(wait, minPublicationWait+publicationBackoff.Delay(failures)), maxPublicationWait)
+			failures++
+		} else {
+			failures = 0
+		}
+		worker.recordRun(err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (worker *PublicationWorker) setRunning(running bool) {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	worker.running = running
+}
+
+func (worker *PublicationWorker) recordRun(err error) {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	worker.lastRun = time.Now().UTC()
+	worker.lastError = err
+}
+
+// release Release the due programs and schedules, returning the last error met
+func (worker *PublicationWorker) release(ctx context.Context) error {
+	programIds, err := repository.ReleaseEmbargoedPrograms(ctx, worker.Db)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error while releasing embargoed programs", "error", err)
+	}
+	for _, id := range programIds {
+		worker.Broker.Publish(events.Event{Type: events.ProgramReleased, Id: id, Time: time.Now().UTC()})
+	}
+
+	scheduleIds, scheduleErr := repository.ReleaseEmbargoedSchedules(ctx, worker.Db)
+	if scheduleErr != nil {
+		slog.ErrorContext(ctx, "Error while releasing embargoed schedules", "error", scheduleErr)
+		err = scheduleErr
+	}
+	for _, id := range scheduleIds {
+		worker.Broker.Publish(events.Event{Type: events.ScheduleReleased, Id: id, Time: time.Now().UTC()})
+	}
+	return err
+}